@@ -0,0 +1,108 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package solver
+
+import (
+	"fmt"
+
+	"github.com/pawelz/efilfoemag/src/cnf"
+	"github.com/pawelz/efilfoemag/src/grid"
+)
+
+// MinimalOrphan shrinks a Garden of Eden to a minimal orphan pattern.
+//
+// The returned pattern has the cells of the target, but only some of them are
+// fixed. It still has no parents, and releasing any of its fixed cells would
+// give it some, so these cells are the local configuration that makes the
+// target impossible. It returns nil and no error iff the target has parents.
+//
+// The cells are switched on and off with the selectors of
+// cnf.EncodeSelectable. Every time the SAT solver fails, only the cells in its
+// core are kept, and then the remaining cells are released one by one,
+// keeping those without which the pattern gets a parent.
+//
+// So it takes up to one SAT call per cell of the target, all on the same
+// solver, which keeps what it learns between the calls. The calls finding a
+// parent are as costly as the SAT strategy on the whole target, so e.g. an
+// 8x8 torus takes several seconds.
+func MinimalOrphan(target *grid.Grid) (*grid.Pattern, error) {
+	f, err := cnf.EncodeSelectable(target)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode the target: %v", err)
+	}
+	s, ok, err := loadSATSolver(f)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("the formula is unsatisfiable with no cells fixed")
+	}
+	w, h := target.Width(), target.Height()
+	fixed := map[int]bool{}
+	var selectors []int
+	for y := uint(0); y < h; y++ {
+		for x := uint(0); x < w; x++ {
+			selectors = append(selectors, cnf.SelectorVar(w, h, x, y))
+			fixed[cnf.SelectorVar(w, h, x, y)] = true
+		}
+	}
+	// solve returns true iff the pattern of the fixed cells has parents. If
+	// not, only the cells of the core stay fixed.
+	solve := func() (bool, error) {
+		var assumptions []int
+		for _, v := range selectors {
+			if fixed[v] {
+				assumptions = append(assumptions, v)
+			}
+		}
+		ok, err := s.SolveAssuming(assumptions)
+		if err != nil || ok {
+			return ok, err
+		}
+		fixed = map[int]bool{}
+		for _, v := range s.Core() {
+			fixed[v] = true
+		}
+		return false, nil
+	}
+	if ok, err := solve(); err != nil || ok {
+		return nil, err
+	}
+	for _, v := range selectors {
+		if !fixed[v] {
+			continue
+		}
+		delete(fixed, v)
+		ok, err := solve()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			fixed[v] = true
+		}
+	}
+	rv := grid.NewPattern(target)
+	for y := uint(0); y < h; y++ {
+		for x := uint(0); x < w; x++ {
+			if fixed[cnf.SelectorVar(w, h, x, y)] {
+				continue
+			}
+			if err := rv.Release(x, y); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return rv, nil
+}
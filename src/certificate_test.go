@@ -0,0 +1,114 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package solver
+
+import (
+	"testing"
+
+	"github.com/pawelz/efilfoemag/src/cnf"
+	"github.com/pawelz/efilfoemag/src/grid"
+	"github.com/pawelz/efilfoemag/src/sat"
+)
+
+// hasParents returns true iff the pattern has parents.
+func hasParents(p *grid.Pattern, t *testing.T) bool {
+	t.Helper()
+	f, err := cnf.EncodePattern(p)
+	if err != nil {
+		t.Fatalf("cannot encode the pattern: %v", err)
+	}
+	s := sat.New(f.NumVars)
+	for _, clause := range f.Clauses {
+		if _, err := s.AddClause(clause); err != nil {
+			t.Fatalf("cannot add a clause: %v", err)
+		}
+	}
+	return s.Solve()
+}
+
+func TestMinimalOrphan(t *testing.T) {
+	for _, td := range []struct {
+		name   string
+		target string
+		orphan bool
+	}{
+		{
+			name: "all alive",
+			target: `8x8
+########
+########
+########
+########
+########
+########
+########
+########
+`,
+			orphan: true,
+		},
+		{
+			name: "glider",
+			target: `8x8
+++++++++
++++#++++
+++++#+++
+++###+++
+++++++++
+++++++++
+++++++++
+++++++++
+`,
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			target := parseGrid(td.target, t)
+			got, err := MinimalOrphan(target)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !td.orphan {
+				if got != nil {
+					t.Errorf("want no certificate, got:\n%s", got.ToEfil())
+				}
+				return
+			}
+			if got == nil {
+				t.Fatalf("want a certificate, got none")
+			}
+			if hasParents(got, t) {
+				t.Fatalf("the certificate has parents:\n%s", got.ToEfil())
+			}
+			for y := uint(0); y < got.Height(); y++ {
+				for x := uint(0); x < got.Width(); x++ {
+					s, fixed, err := got.Get(x, y)
+					if err != nil {
+						t.Fatalf("unexpected error: %v", err)
+					}
+					if !fixed {
+						continue
+					}
+					if want, _ := target.Get(x, y); s != want {
+						t.Errorf("at (%d, %d) want %v, got %v", x, y, want, s)
+					}
+					released, _ := grid.ParsePattern(got.ToEfil())
+					released.Release(x, y)
+					if !hasParents(released, t) {
+						t.Errorf("the certificate is not minimal, (%d, %d) is not needed:\n%s", x, y, got.ToEfil())
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,641 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cnf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pawelz/efilfoemag/src/grid"
+	"github.com/pawelz/efilfoemag/src/neighborhood"
+	"github.com/pawelz/efilfoemag/src/state"
+)
+
+// Formula is a propositional formula in the conjunctive normal form.
+//
+// Variables are numbered from 1. A positive literal v means that the variable
+// v is true, a negative literal -v means that it is false.
+type Formula struct {
+	NumVars int
+	Clauses [][]int
+}
+
+// cube is a set of neighborhoods sharing the states of some of their cells.
+//
+// The cube contains a neighborhood n iff n&mask == value.
+type cube struct {
+	value uint16
+	mask  uint16
+}
+
+// covers holds the cubes forbidden for the living and the dead cells under a rule.
+type covers struct {
+	forbiddenForAlive []cube
+	forbiddenForDead  []cube
+	// forbiddenForDying holds the cubes forbidden for the dying cells of
+	// the Generations rules, by state, as they are needed.
+	forbiddenForDying map[state.State][]cube
+}
+
+// ruleKey identifies a rule by what its covers depend on, so that the same
+// rule parsed twice shares its covers.
+type ruleKey struct {
+	table  string
+	shape  neighborhood.Shape
+	states int
+}
+
+// maxCachedRules is the number of rules whose covers are kept, see coversOf.
+const maxCachedRules = 16
+
+var (
+	// coversByRule caches the covers of the rules, as they are costly to
+	// compute. It is guarded by coversMu, and dropped when it grows over
+	// maxCachedRules.
+	coversByRule = map[ruleKey]*covers{}
+	coversMu     sync.Mutex
+)
+
+// coversOf returns the covers of the rule.
+func coversOf(r *neighborhood.Rule) *covers {
+	key := ruleKey{table: string(r.Table()), shape: r.Shape(), states: r.States()}
+	coversMu.Lock()
+	defer coversMu.Unlock()
+	if c, ok := coversByRule[key]; ok {
+		return c
+	}
+	c := &covers{
+		forbiddenForAlive: cover(complement(r.Ancestors(state.Alive), r)),
+		forbiddenForDead:  cover(complement(r.Ancestors(state.Dead), r)),
+		forbiddenForDying: map[state.State][]cube{},
+	}
+	if len(coversByRule) >= maxCachedRules {
+		coversByRule = map[ruleKey]*covers{}
+	}
+	coversByRule[key] = c
+	return c
+}
+
+// forbidden returns the cubes forbidden for the cells of the given state under the rule.
+func (c *covers) forbidden(r *neighborhood.Rule, s state.State) []cube {
+	switch {
+	case s.IsAlive():
+		return c.forbiddenForAlive
+	case s == state.Dead:
+		return c.forbiddenForDead
+	}
+	coversMu.Lock()
+	defer coversMu.Unlock()
+	if _, ok := c.forbiddenForDying[s]; !ok {
+		c.forbiddenForDying[s] = cover(complement(r.Ancestors(s), r))
+	}
+	return c.forbiddenForDying[s]
+}
+
+// complement returns the set of the neighborhoods of the rule not in the given set.
+//
+// The cells outside of the neighborhood of the rule are dead in all of them,
+// see neighborhood.Rule.Sides.
+func complement(s *neighborhood.Set, r *neighborhood.Rule) *neighborhood.Set {
+	var outside neighborhood.Neighborhood = 0x1ff
+	for _, side := range r.Sides() {
+		outside &^= 1 << uint(side)
+	}
+	rv := &neighborhood.Set{}
+	for n := neighborhood.Neighborhood(0); n < 0x200; n++ {
+		if ok, _ := s.Contains(n); !ok && n&outside == 0 {
+			rv.Add(n)
+		}
+	}
+	return rv
+}
+
+// cover returns a small list of cubes whose union is exactly the given set.
+//
+// This is the Quine-McCluskey method: it merges the neighborhoods into prime
+// implicants, and then greedily picks the ones covering most of the set.
+func cover(s *neighborhood.Set) []cube {
+	level := map[cube]bool{}
+	for _, n := range s.Elements() {
+		level[cube{value: uint16(n), mask: 0x1ff}] = true
+	}
+	var primes []cube
+	for len(level) > 0 {
+		next := map[cube]bool{}
+		merged := map[cube]bool{}
+		for c := range level {
+			for b := uint(0); b < 9; b++ {
+				bit := uint16(1) << b
+				if c.mask&bit == 0 || c.value&bit != 0 {
+					continue
+				}
+				if o := (cube{value: c.value | bit, mask: c.mask}); level[o] {
+					next[cube{value: c.value, mask: c.mask &^ bit}] = true
+					merged[c] = true
+					merged[o] = true
+				}
+			}
+		}
+		for c := range level {
+			if !merged[c] {
+				primes = append(primes, c)
+			}
+		}
+		level = next
+	}
+
+	uncovered := map[neighborhood.Neighborhood]bool{}
+	for _, n := range s.Elements() {
+		uncovered[n] = true
+	}
+	var rv []cube
+	for len(uncovered) > 0 {
+		best, bestCount := cube{}, -1
+		for _, c := range primes {
+			var count int
+			for n := range uncovered {
+				if uint16(n)&c.mask == c.value {
+					count++
+				}
+			}
+			// Ties are broken deterministically, to keep the output stable.
+			if count > bestCount || count == bestCount && (c.mask < best.mask || c.mask == best.mask && c.value < best.value) {
+				best, bestCount = c, count
+			}
+		}
+		for n := range uncovered {
+			if uint16(n)&best.mask == best.value {
+				delete(uncovered, n)
+			}
+		}
+		rv = append(rv, best)
+	}
+	return rv
+}
+
+// Var returns the variable representing the parent cell at the given address.
+//
+// The variables are assigned to the cells in the row-major order.
+func Var(width, x, y uint) int {
+	return int(y*width+x) + 1
+}
+
+// Encode returns a formula whose models are exactly the parents of the target.
+//
+// There is one variable per parent cell, see Var. For every cell of the target
+// the formula forbids all the parent neighborhoods that do not evolve into
+// its state. Cells out of range are resolved with the topology of the target.
+func Encode(target *grid.Grid) (*Formula, error) {
+	return EncodeGenerations(target, 1)
+}
+
+// EncodeSymmetric returns Encode restricted to the parents invariant under the symmetry.
+//
+// Every parent cell is tied to its representative, see
+// grid.Symmetry.Representative, with the clauses making their variables equal.
+// It returns an error if the symmetry does not fit the target, see
+// grid.Symmetry.Check.
+func EncodeSymmetric(target *grid.Grid, symmetry *grid.Symmetry) (*Formula, error) {
+	if err := symmetry.Check(target); err != nil {
+		return nil, err
+	}
+	f, err := Encode(target)
+	if err != nil {
+		return nil, err
+	}
+	w, h := target.Width(), target.Height()
+	for y := uint(0); y < h; y++ {
+		for x := uint(0); x < w; x++ {
+			rx, ry := symmetry.Representative(x, y, w, h)
+			if rx == x && ry == y {
+				continue
+			}
+			v, r := Var(w, x, y), Var(w, rx, ry)
+			f.Clauses = append(f.Clauses, []int{-v, r}, []int{v, -r})
+		}
+	}
+	return f, nil
+}
+
+// GenerationVar returns the variable representing the cell at the given address in the generation g.
+//
+// The generations are numbered as in EncodeGenerations. The variables of the
+// generation 0 are the same as the ones of Var.
+func GenerationVar(width, height uint, g int, x, y uint) int {
+	return g*int(width*height) + Var(width, x, y)
+}
+
+// EncodeGenerations returns a formula whose models are exactly the chains of k generations of ancestors of the target.
+//
+// The generation 0 is the oldest one, every generation evolves into the next
+// one, and the generation k-1 evolves into the target. See GenerationVar for
+// the variables. The cells of the target are fixed, so the formula forbids the
+// same neighborhoods as Encode. The cells of the other generations are
+// variables, so every such clause is extended with the literal of the cell.
+// The rule of the target evolves the generation k-1, and every older one
+// follows the rule before, see neighborhood.Rule.Previous: the rules relative
+// to a strobing background take turns, see grid.Grid.Relative.
+func EncodeGenerations(target *grid.Grid, k int) (*Formula, error) {
+	return encode(grid.NewPattern(target), k, false)
+}
+
+// EncodePattern returns a formula whose models are exactly the parents of the pattern.
+//
+// These are the grids evolving into the fixed cells of the pattern, no matter
+// what becomes of the other cells. The variables are the same as in Encode.
+func EncodePattern(target *grid.Pattern) (*Formula, error) {
+	return encode(target, 1, false)
+}
+
+// SelectorVar returns the selector of the target cell at the given address, see EncodeSelectable.
+func SelectorVar(width, height, x, y uint) int {
+	return int(width*height) + Var(width, x, y)
+}
+
+// EncodeSelectable returns Encode extended with a selector variable per target cell.
+//
+// The clauses of every target cell are only enforced if its selector, see
+// SelectorVar, is true. Assuming some selectors true, and leaving the others
+// free, is the same as leaving the cells of the latter "don't care", so the
+// same formula can be solved for many patterns.
+func EncodeSelectable(target *grid.Grid) (*Formula, error) {
+	return encode(grid.NewPattern(target), 1, true)
+}
+
+// encode implements EncodeGenerations, EncodePattern and EncodeSelectable.
+func encode(target *grid.Pattern, k int, selectors bool) (*Formula, error) {
+	if k < 1 {
+		return nil, fmt.Errorf("want at least one generation, got %d", k)
+	}
+	if err := target.CheckRelative(); err != nil {
+		return nil, err
+	}
+	if k > 1 && target.Rule().States() > 2 {
+		return nil, fmt.Errorf("the generations of ancestors are not supported under the %s rule with dying states", target.Rule())
+	}
+	w, h := target.Width(), target.Height()
+	// rules[g] evolves the generation g, see neighborhood.Rule.Previous.
+	rules := make([]*neighborhood.Rule, k)
+	rules[k-1] = target.Rule()
+	for g := k - 2; g >= 0; g-- {
+		var err error
+		if rules[g], err = rules[g+1].Previous(); err != nil {
+			return nil, fmt.Errorf("cannot encode the generation %d: %v", g, err)
+		}
+	}
+	f := &Formula{NumVars: k * int(w*h)}
+	if selectors {
+		f.NumVars += int(w * h)
+	}
+	for g := 0; g < k; g++ {
+		covers := coversOf(rules[g])
+		for y := uint(0); y < h; y++ {
+			for x := uint(0); x < w; x++ {
+				// Cells outside of the grid, or of the neighborhood of
+				// the rule, are left as 0.
+				var vars [9]int
+				for _, side := range target.Rule().Sides() {
+					dx, dy := side.Offset()
+					if nx, ny, ok := target.Topology().Resolve(int(x)+dx, int(y)+dy, w, h); ok {
+						vars[side] = GenerationVar(w, h, g, nx, ny)
+					}
+				}
+				if g == k-1 {
+					st, fixed, err := target.Get(x, y)
+					if err != nil {
+						return nil, fmt.Errorf("cannot read the target: %v", err)
+					}
+					if !fixed {
+						continue
+					}
+					for _, c := range covers.forbidden(target.Rule(), st) {
+						clause := c.clause(vars)
+						if clause == nil {
+							continue
+						}
+						if selectors {
+							clause = append(clause, -SelectorVar(w, h, x, y))
+						}
+						f.Clauses = append(f.Clauses, clause)
+					}
+					continue
+				}
+				child := GenerationVar(w, h, g+1, x, y)
+				for _, c := range covers.forbiddenForAlive {
+					if clause := c.clause(vars); clause != nil {
+						f.Clauses = append(f.Clauses, append(clause, -child))
+					}
+				}
+				for _, c := range covers.forbiddenForDead {
+					if clause := c.clause(vars); clause != nil {
+						f.Clauses = append(f.Clauses, append(clause, child))
+					}
+				}
+			}
+		}
+	}
+	return f, nil
+}
+
+// clause returns the clause forbidding the cube, given the variables of the neighborhood cells.
+//
+// The variable 0 stands for a cell that is always dead. It returns nil if the
+// clause is always satisfied, which is possible when some cells of the
+// neighborhood are the same parent cell, or when the cube needs a living cell
+// where it is always dead.
+func (c cube) clause(vars [9]int) []int {
+	lits := map[int]bool{}
+	// The clause may be empty, but not nil, if the cube is certain.
+	rv := []int{}
+	for b := uint(0); b < 9; b++ {
+		if c.mask&(1<<b) == 0 {
+			continue
+		}
+		if vars[b] == 0 {
+			if c.value&(1<<b) != 0 {
+				return nil
+			}
+			continue
+		}
+		lit := vars[b]
+		if c.value&(1<<b) != 0 {
+			lit = -lit
+		}
+		if lits[-lit] {
+			return nil
+		}
+		if !lits[lit] {
+			lits[lit] = true
+			rv = append(rv, lit)
+		}
+	}
+	return rv
+}
+
+// Counter adds a unary counter of the true literals, counting up to k.
+//
+// This is the sequential counter encoding: a new variable s(i, j) is forced
+// true if at least j+1 of the first i+1 literals are true. The returned
+// variables are s(len(lits)-1, j) for j from 0 to k-1, so forbidding the
+// variable j allows at most j of the literals to be true.
+func (f *Formula) Counter(lits []int, k int) []int {
+	var prev []int
+	for i, l := range lits {
+		s := make([]int, k)
+		for j := range s {
+			f.NumVars++
+			s[j] = f.NumVars
+			switch {
+			case j == 0:
+				f.Clauses = append(f.Clauses, []int{-l, s[j]})
+			case i > 0:
+				f.Clauses = append(f.Clauses, []int{-l, -prev[j-1], s[j]})
+			}
+			if i > 0 {
+				f.Clauses = append(f.Clauses, []int{-prev[j], s[j]})
+			}
+		}
+		prev = s
+	}
+	return prev
+}
+
+// AtMost adds clauses allowing at most k of the literals to be true.
+//
+// A negative k makes the formula unsatisfiable.
+func (f *Formula) AtMost(lits []int, k int) {
+	switch {
+	case k < 0:
+		f.Clauses = append(f.Clauses, []int{})
+	case k < len(lits):
+		outputs := f.Counter(lits, k+1)
+		f.Clauses = append(f.Clauses, []int{-outputs[k]})
+	}
+}
+
+// Sum adds a binary adder of the literals, and returns the bits of the number of the true ones, least significant first.
+//
+// The literal 0 is always false, and so are the bits 0 of the result. Every
+// bit is equivalent to its value, so the number can be bounded either way.
+func (f *Formula) Sum(lits []int) []int {
+	numbers := make([][]int, len(lits))
+	for i, l := range lits {
+		numbers[i] = []int{l}
+	}
+	return f.SumNumbers(numbers)
+}
+
+// SumNumbers adds a tree of binary adders of the numbers, and returns the bits of their sum, see Sum.
+func (f *Formula) SumNumbers(numbers [][]int) []int {
+	if len(numbers) == 0 {
+		return nil
+	}
+	for len(numbers) > 1 {
+		var next [][]int
+		for i := 0; i+1 < len(numbers); i += 2 {
+			next = append(next, f.Add(numbers[i], numbers[i+1]))
+		}
+		if len(numbers)%2 == 1 {
+			next = append(next, numbers[len(numbers)-1])
+		}
+		numbers = next
+	}
+	return numbers[0]
+}
+
+// Add adds a ripple-carry adder of two binary numbers, and returns the bits of their sum, see Sum.
+func (f *Formula) Add(a, b []int) []int {
+	var rv []int
+	carry := 0
+	for i := 0; i < len(a) || i < len(b) || carry != 0; i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		var sum int
+		sum, carry = f.fullAdder(x, y, carry)
+		rv = append(rv, sum)
+	}
+	return rv
+}
+
+// fullAdder returns new variables equivalent to the sum and the carry of the three literals.
+//
+// The literals 0 are always false, and they are left out.
+func (f *Formula) fullAdder(a, b, c int) (int, int) {
+	var in []int
+	for _, l := range []int{a, b, c} {
+		if l != 0 {
+			in = append(in, l)
+		}
+	}
+	switch len(in) {
+	case 0:
+		return 0, 0
+	case 1:
+		return in[0], 0
+	}
+	f.NumVars += 2
+	sum, carry := f.NumVars-1, f.NumVars
+	// Every assignment of the inputs forces the sum and the carry.
+	for m := 0; m < 1<<uint(len(in)); m++ {
+		clause := make([]int, len(in))
+		var ones int
+		for i, l := range in {
+			if m>>uint(i)&1 == 1 {
+				clause[i] = -l
+				ones++
+			} else {
+				clause[i] = l
+			}
+		}
+		s, c := sum, carry
+		if ones%2 == 0 {
+			s = -sum
+		}
+		if ones < 2 {
+			c = -carry
+		}
+		f.Clauses = append(f.Clauses, append(append([]int{}, clause...), s), append(clause, c))
+	}
+	return sum, carry
+}
+
+// NotEqual adds a clause that the binary number, see Sum, is not the given value, or one of the literals is true.
+func (f *Formula) NotEqual(bits []int, value int, lits ...int) {
+	if value>>uint(len(bits)) != 0 {
+		return
+	}
+	clause := append([]int{}, lits...)
+	for i, b := range bits {
+		one := value>>uint(i)&1 == 1
+		switch {
+		case b == 0 && one:
+			return
+		case b == 0:
+			continue
+		case one:
+			clause = append(clause, -b)
+		default:
+			clause = append(clause, b)
+		}
+	}
+	f.Clauses = append(f.Clauses, clause)
+}
+
+// WriteDIMACS writes the formula in the DIMACS CNF format.
+func (f *Formula) WriteDIMACS(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "p cnf %d %d\n", f.NumVars, len(f.Clauses))
+	for _, clause := range f.Clauses {
+		for _, lit := range clause {
+			bw.WriteString(strconv.Itoa(lit))
+			bw.WriteByte(' ')
+		}
+		bw.WriteString("0\n")
+	}
+	return bw.Flush()
+}
+
+// WriteVarMap writes the map of variables to the addresses of parent cells.
+//
+// Every line consists of the variable, and the x and y coordinates of the
+// cell, separated with spaces.
+func WriteVarMap(w io.Writer, width, height uint) error {
+	bw := bufio.NewWriter(w)
+	for y := uint(0); y < height; y++ {
+		for x := uint(0); x < width; x++ {
+			fmt.Fprintf(bw, "%d %d %d\n", Var(width, x, y), x, y)
+		}
+	}
+	return bw.Flush()
+}
+
+// DecodeModel turns the output of a SAT solver into a parent grid.
+//
+// The output is expected in the SAT competition format: the "v" lines list the
+// literals of the model, the "s" line reports the status, all other lines are
+// ignored. Variables missing from the model are taken as dead cells. It returns
+// nil and no error iff the solver reported the formula unsatisfiable, i.e. the
+// target is a Garden of Eden.
+func DecodeModel(output []byte, width, height uint) (*grid.Grid, error) {
+	return DecodeModelOf(output, width, height, int(width*height))
+}
+
+// DecodeModelOf is DecodeModel for the formulas of numVars variables.
+//
+// The variables beyond the cells of the parent are the auxiliary ones of the
+// encoding, and they are ignored.
+func DecodeModelOf(output []byte, width, height uint, numVars int) (*grid.Grid, error) {
+	parent, err := grid.New(int(width), int(height))
+	if err != nil {
+		return nil, err
+	}
+	var seenModel bool
+	s := bufio.NewScanner(bytes.NewReader(output))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "s":
+			if status := strings.Join(fields[1:], " "); status == "UNSATISFIABLE" {
+				return nil, nil
+			} else if status != "SATISFIABLE" {
+				return nil, fmt.Errorf("unexpected solver status %q", status)
+			}
+		case "v":
+			seenModel = true
+			for _, field := range fields[1:] {
+				lit, err := strconv.Atoi(field)
+				if err != nil {
+					return nil, fmt.Errorf("invalid literal %q: %v", field, err)
+				}
+				v := lit
+				if v < 0 {
+					v = -v
+				}
+				if v == 0 {
+					continue
+				}
+				if v > numVars {
+					return nil, fmt.Errorf("variable %d is out of range (1-%d)", v, numVars)
+				}
+				if v > int(width*height) {
+					continue
+				}
+				if err := parent.Set(uint(v-1)%width, uint(v-1)/width, state.Of(lit > 0)); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read the solver output: %v", err)
+	}
+	if !seenModel {
+		return nil, fmt.Errorf("no model in the solver output")
+	}
+	return parent, nil
+}
@@ -0,0 +1,449 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cnf
+
+import (
+	"bytes"
+	"fmt"
+	"math/bits"
+	"testing"
+
+	"github.com/pawelz/efilfoemag/src/grid"
+	"github.com/pawelz/efilfoemag/src/neighborhood"
+)
+
+func parseGrid(input string, t *testing.T) *grid.Grid {
+	t.Helper()
+	g, err := grid.Parse([]byte(input))
+	if err != nil {
+		t.Fatalf("cannot parse testdata: %v", err)
+	}
+	return g
+}
+
+// satisfies returns true iff the grid, taken as an assignment, satisfies the formula.
+func satisfies(f *Formula, g *grid.Grid) bool {
+	return satisfiesAll(f, func(v int) bool {
+		s, _ := g.Get(uint(v-1)%g.Width(), uint(v-1)/g.Width())
+		return s.IsAlive()
+	})
+}
+
+func TestCover(t *testing.T) {
+	for _, td := range []struct {
+		name string
+		set  *neighborhood.Set
+	}{
+		{name: "ancestors of alive", set: neighborhood.GetAncestorsOfAlive()},
+		{name: "ancestors of dead", set: neighborhood.GetAncestorsOfDead()},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			cubes := cover(td.set)
+			for n := neighborhood.Neighborhood(0); n < 0x200; n++ {
+				var covered bool
+				for _, c := range cubes {
+					if uint16(n)&c.mask == c.value {
+						covered = true
+					}
+				}
+				if want, _ := td.set.Contains(n); covered != want {
+					t.Errorf("for %q want covered = %v, got %v", n.ToStr(), want, covered)
+				}
+			}
+			if size := td.set.Size(); len(cubes) >= size {
+				t.Errorf("want fewer than %d cubes, got %d", size, len(cubes))
+			}
+		})
+	}
+}
+
+func TestCoversOf(t *testing.T) {
+	rules := make([]*neighborhood.Rule, 8)
+	for i := range rules {
+		var err error
+		if rules[i], err = neighborhood.ParseRule("B36/S23"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := make(chan *covers)
+	for _, r := range rules {
+		go func(r *neighborhood.Rule) {
+			got <- coversOf(r)
+		}(r)
+	}
+	want := <-got
+	for i := 1; i < len(rules); i++ {
+		if c := <-got; c != want {
+			t.Errorf("the same rule parsed twice got different covers")
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	target := parseGrid(`8x8
+++++++++
+++++++++
+++++++++
+++###+++
+++++++++
+++++++++
+++++++++
+##+++++#
+`, t)
+	f, err := Encode(target)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.NumVars != 64 {
+		t.Errorf("want 64 variables, got %d", f.NumVars)
+	}
+	for _, td := range []struct {
+		name   string
+		grid   string
+		parent bool
+	}{
+		{
+			name: "parent",
+			grid: `8x8
+#+++++++
+++++++++
++++#++++
++++#++++
++++#++++
+++++++++
+#+++++++
+#+++++++
+`,
+			parent: true,
+		},
+		{
+			name: "not a parent",
+			grid: `8x8
+++++++++
+++++++++
++++#++++
++++#++++
++++#++++
+++++++++
+#+++++++
+#+++++++
+`,
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			if got := satisfies(f, parseGrid(td.grid, t)); got != td.parent {
+				t.Errorf("want %v, got %v", td.parent, got)
+			}
+		})
+	}
+}
+
+func TestEncodeAbsolute(t *testing.T) {
+	rule, err := neighborhood.ParseRule("B0/S8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := parseGrid("4x4 torus alive\n####\n####\n####\n####\n", t)
+	target.SetRule(rule)
+	if _, err := Encode(target); err == nil {
+		t.Errorf("expected an error under the %s rule", rule)
+	}
+	relative, err := target.Relative()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := Encode(relative); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWriteDIMACS(t *testing.T) {
+	f := &Formula{
+		NumVars: 3,
+		Clauses: [][]int{{1, -2}, {2, 3, -1}, {-3}},
+	}
+	var buf bytes.Buffer
+	if err := f.WriteDIMACS(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "p cnf 3 3\n1 -2 0\n2 3 -1 0\n-3 0\n"
+	if got := buf.String(); got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestWriteVarMap(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteVarMap(&buf, 2, 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "1 0 0\n2 1 0\n3 0 1\n4 1 1\n"
+	if got := buf.String(); got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestDecodeModel(t *testing.T) {
+	for _, td := range []struct {
+		name    string
+		output  string
+		want    string
+		orphan  bool
+		failure bool
+		// numVars is the number of variables of the formula, if not one
+		// per cell.
+		numVars int
+	}{
+		{
+			name: "satisfiable",
+			output: `c some comment
+s SATISFIABLE
+v -1 2 -3 -4 -5 -6 -7 -8 9 10 11 12 13 14 15 16
+v 17 -18 19 0
+`,
+			want: `8x8
++#++++++
+########
+#+#+++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+`,
+		},
+		{
+			name:   "unsatisfiable",
+			output: "s UNSATISFIABLE\n",
+			orphan: true,
+		},
+		{
+			name:    "unknown",
+			output:  "s UNKNOWN\n",
+			failure: true,
+		},
+		{
+			name:    "no model",
+			output:  "s SATISFIABLE\n",
+			failure: true,
+		},
+		{
+			name:    "out of range",
+			output:  "s SATISFIABLE\nv 65 0\n",
+			failure: true,
+		},
+		{
+			name:    "auxiliary variables",
+			output:  "s SATISFIABLE\nv 2 -65 66 0\n",
+			numVars: 66,
+			want: `8x8
++#++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+`,
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			got, err := DecodeModel([]byte(td.output), 8, 8)
+			if td.numVars != 0 {
+				got, err = DecodeModelOf([]byte(td.output), 8, 8, td.numVars)
+			}
+			if td.failure {
+				if err == nil {
+					t.Errorf("expected a failure, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if td.orphan {
+				if got != nil {
+					t.Errorf("want no parent, got:\n%s", got.ToEfil())
+				}
+				return
+			}
+			if want := parseGrid(td.want, t); !want.EqualsTo(got) {
+				t.Errorf("want:\n%s\ngot:\n%s", want.ToEfil(), got.ToEfil())
+			}
+		})
+	}
+}
+
+func TestAtMost(t *testing.T) {
+	const n = 4
+	for k := -1; k <= n+1; k++ {
+		t.Run(fmt.Sprintf("k=%d", k), func(t *testing.T) {
+			f := &Formula{NumVars: n + 1}
+			// The last variable is negated, to cover negative literals.
+			f.AtMost([]int{1, 2, 3, -5}, k)
+			for x := 0; x < 1<<n; x++ {
+				count := bits.OnesCount(uint(x))
+				// The literal -5 is true iff the bit 3 is set.
+				assignment := func(v int) bool {
+					switch {
+					case v <= 3:
+						return x&(1<<uint(v-1)) != 0
+					case v == 5:
+						return x&8 == 0
+					}
+					return false
+				}
+				var sat bool
+				aux := f.NumVars - n - 1
+				for a := 0; a < 1<<uint(aux) && !sat; a++ {
+					sat = satisfiesAll(f, func(v int) bool {
+						if v <= n+1 {
+							return assignment(v)
+						}
+						return a&(1<<uint(v-n-2)) != 0
+					})
+				}
+				if want := count <= k; sat != want {
+					t.Errorf("for %04b want satisfiable = %v, got %v", x, want, sat)
+				}
+			}
+		})
+	}
+}
+
+func TestSum(t *testing.T) {
+	const n = 4
+	for v := 0; v <= n+1; v++ {
+		t.Run(fmt.Sprintf("v=%d", v), func(t *testing.T) {
+			f := &Formula{NumVars: n + 1}
+			// The literal 0 is always false, and the last variable is
+			// negated, to cover negative literals.
+			sum := f.Sum([]int{1, 0, 2, 3, -5})
+			f.NotEqual(sum, v)
+			for x := 0; x < 1<<n; x++ {
+				count := bits.OnesCount(uint(x))
+				assignment := func(v int) bool {
+					switch {
+					case v <= 3:
+						return x&(1<<uint(v-1)) != 0
+					case v == 5:
+						return x&8 == 0
+					}
+					return false
+				}
+				var sat bool
+				aux := f.NumVars - n - 1
+				for a := 0; a < 1<<uint(aux) && !sat; a++ {
+					sat = satisfiesAll(f, func(v int) bool {
+						if v <= n+1 {
+							return assignment(v)
+						}
+						return a&(1<<uint(v-n-2)) != 0
+					})
+				}
+				if want := count != v; sat != want {
+					t.Errorf("for %04b want satisfiable = %v, got %v", x, want, sat)
+				}
+			}
+		})
+	}
+}
+
+// satisfiesAll returns true iff the assignment satisfies all clauses of the formula.
+func satisfiesAll(f *Formula, assignment func(v int) bool) bool {
+	for _, clause := range f.Clauses {
+		var sat bool
+		for _, lit := range clause {
+			if lit > 0 && assignment(lit) || lit < 0 && !assignment(-lit) {
+				sat = true
+				break
+			}
+		}
+		if !sat {
+			return false
+		}
+	}
+	return true
+}
+
+func TestEncodeGenerations(t *testing.T) {
+	target := parseGrid(`8x8
+++++++++
+++++++++
+++++++++
+++###+++
+++++++++
+++++++++
+++++++++
+++++++++
+`, t)
+	if _, err := EncodeGenerations(target, 0); err == nil {
+		t.Errorf("expected a failure for no generations")
+	}
+	f, err := EncodeGenerations(target, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.NumVars != 128 {
+		t.Errorf("want 128 variables, got %d", f.NumVars)
+	}
+	horizontal := parseGrid(`8x8
+++++++++
+++++++++
+++++++++
+++###+++
+++++++++
+++++++++
+++++++++
+++++++++
+`, t)
+	vertical := parseGrid(`8x8
+++++++++
+++++++++
++++#++++
++++#++++
++++#++++
+++++++++
+++++++++
+++++++++
+`, t)
+	for _, td := range []struct {
+		name  string
+		chain []*grid.Grid
+		want  bool
+	}{
+		{
+			name:  "blinker",
+			chain: []*grid.Grid{horizontal, vertical},
+			want:  true,
+		},
+		{
+			name:  "out of phase",
+			chain: []*grid.Grid{vertical, vertical},
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			got := satisfiesAll(f, func(v int) bool {
+				g := td.chain[(v-1)/64]
+				s, _ := g.Get(uint(v-1)%8, uint(v-1)%64/8)
+				return s.IsAlive()
+			})
+			if got != td.want {
+				t.Errorf("want %v, got %v", td.want, got)
+			}
+		})
+	}
+}
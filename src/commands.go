@@ -0,0 +1,159 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/pawelz/efilfoemag/src/grid"
+	"github.com/pawelz/efilfoemag/src/hashlife"
+)
+
+// command is a subcommand of efilfoemag, which reads a grid, transforms it and writes the result to the standard output.
+//
+// The commands are run as "efilfoemag <name> --input=<file> [flags]", see runCommand.
+type command struct {
+	name string
+	// setup defines the flags of the command, and returns the transformation of the grid they set up.
+	setup func(fs *flag.FlagSet) func(g *grid.Grid) (*grid.Grid, error)
+}
+
+var commands = []command{
+	{
+		name: "transform",
+		setup: func(fs *flag.FlagSet) func(g *grid.Grid) (*grid.Grid, error) {
+			name := fs.String("by", "", fmt.Sprintf("The symmetry of the square to transform the grid by, one of %v.", grid.TransformNames()))
+			return func(g *grid.Grid) (*grid.Grid, error) {
+				t, err := grid.TransformByName(*name)
+				if err != nil {
+					return nil, err
+				}
+				return g.Transform(t), nil
+			}
+		},
+	},
+	{
+		name: "translate",
+		setup: func(fs *flag.FlagSet) func(g *grid.Grid) (*grid.Grid, error) {
+			dx := fs.Int("dx", 0, "The number of cells to move the grid by to the right, cyclically.")
+			dy := fs.Int("dy", 0, "The number of cells to move the grid by down, cyclically.")
+			return func(g *grid.Grid) (*grid.Grid, error) {
+				return g.Translate(*dx, *dy), nil
+			}
+		},
+	},
+	{
+		name: "crop",
+		setup: func(fs *flag.FlagSet) func(g *grid.Grid) (*grid.Grid, error) {
+			return func(g *grid.Grid) (*grid.Grid, error) {
+				x, y, w, h, ok := g.Bounds()
+				if !ok {
+					return nil, fmt.Errorf("all the cells are the background")
+				}
+				return g.Crop(x, y, w, h)
+			}
+		},
+	},
+	{
+		name: "pad",
+		setup: func(fs *flag.FlagSet) func(g *grid.Grid) (*grid.Grid, error) {
+			margin := fs.Uint("margin", 0, "The number of cells to add on every side, on top of the ones of the flags of the sides.")
+			left := fs.Uint("left", 0, "The number of cells to add on the left.")
+			top := fs.Uint("top", 0, "The number of cells to add on the top.")
+			right := fs.Uint("right", 0, "The number of cells to add on the right.")
+			bottom := fs.Uint("bottom", 0, "The number of cells to add on the bottom.")
+			return func(g *grid.Grid) (*grid.Grid, error) {
+				return g.Pad(*margin+*left, *margin+*top, *margin+*right, *margin+*bottom), nil
+			}
+		},
+	},
+	{
+		name: "embed",
+		setup: func(fs *flag.FlagSet) func(g *grid.Grid) (*grid.Grid, error) {
+			into := fs.String("into", "", "Path to the .efil file of the grid to paste the input into.")
+			x := fs.Uint("x", 0, "The column of the top-left corner of the input in the --into grid.")
+			y := fs.Uint("y", 0, "The row of the top-left corner of the input in the --into grid.")
+			return func(g *grid.Grid) (*grid.Grid, error) {
+				if *into == "" {
+					return nil, fmt.Errorf("missing mandatory flag --into")
+				}
+				target, err := readGrid(*into)
+				if err != nil {
+					return nil, fmt.Errorf("invalid --into: %v", err)
+				}
+				return target.Embed(g, *x, *y)
+			}
+		},
+	},
+	{
+		name: "evolve",
+		setup: func(fs *flag.FlagSet) func(g *grid.Grid) (*grid.Grid, error) {
+			generations := fs.Uint64("generations", 1, "The number of generations to evolve the grid by.")
+			maxNodes := fs.Int("max-nodes", hashlife.DefaultMaxNodes, "The number of the nodes of the quadtree kept between the steps, beyond which the ones not in the pattern are dropped.")
+			return func(g *grid.Grid) (*grid.Grid, error) {
+				if g.Topology() != grid.Plane {
+					return nil, fmt.Errorf("the grid must be on the plane, got the %s topology", g.Topology())
+				}
+				u, err := hashlife.FromGrid(g)
+				if err != nil {
+					return nil, err
+				}
+				u.SetMaxNodes(*maxNodes)
+				if err := u.StepN(*generations); err != nil {
+					return nil, err
+				}
+				rv, _, _, err := u.ToGrid()
+				return rv, err
+			}
+		},
+	},
+}
+
+// commandByName returns the command of the given name, and false if there is none.
+func commandByName(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+// runCommand runs the command with the given arguments, and writes the grid it returns to the standard output in the efil format.
+//
+// The input grid is read from --input, or from the standard input, so that
+// the commands can be piped.
+func runCommand(c command, args []string) {
+	fs := flag.NewFlagSet(c.name, flag.ExitOnError)
+	inputFileName := fs.String("input", "-", fmt.Sprintf("Path to the input .efil file, or - for the standard input. Must be smaller than %dB.", inputCap))
+	run := c.setup(fs)
+	fs.Parse(args)
+	if a := fs.Args(); len(a) != 0 {
+		log.Fatalf("Invalid non-flag arguments %v.\n", a)
+	}
+
+	g, err := readGrid(*inputFileName)
+	if err != nil {
+		log.Fatalf("Invalid --input: %v.", err)
+	}
+	rv, err := run(g)
+	if err != nil {
+		log.Fatalf("Failed to %s %q: %v.", c.name, *inputFileName, err)
+	}
+	os.Stdout.Write(rv.ToEfil())
+}
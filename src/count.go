@@ -0,0 +1,124 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package solver
+
+import (
+	"math/big"
+
+	"github.com/pawelz/efilfoemag/src/grid"
+)
+
+// live returns, for every target line, the pairs of parent lines before it
+// which can be extended to a parent, whatever the anchor.
+//
+// The pairs reachable from the starts are found moving forward, and the ones
+// which cannot reach the last line, or cannot be followed by any line beyond
+// it, are pruned moving backward. Only the pairs are kept, not the anchors, so
+// this is cheap compared with searching the anchored states.
+func (l *lines) live(t []uint64) []map[uint64]bool {
+	n := len(t)
+	reached := make([]map[uint64]bool, n)
+	reached[0] = map[uint64]bool{}
+	for _, state := range l.starts() {
+		_, pair := l.unanchor(state)
+		reached[0][pair] = true
+	}
+	for k := 0; k+1 < n; k++ {
+		reached[k+1] = map[uint64]bool{}
+		for pair := range reached[k] {
+			_, b := l.unpair(pair)
+			for _, c := range l.successors(pair, t[k]) {
+				reached[k+1][l.pair(b, c)] = true
+			}
+		}
+	}
+	rv := make([]map[uint64]bool, n)
+	for k := n - 1; k >= 0; k-- {
+		rv[k] = map[uint64]bool{}
+		for pair := range reached[k] {
+			_, b := l.unpair(pair)
+			for _, c := range l.successors(pair, t[k]) {
+				if k == n-1 || rv[k+1][l.pair(b, c)] {
+					rv[k][pair] = true
+					break
+				}
+			}
+		}
+	}
+	return rv
+}
+
+// count returns the number of parents of the target lines.
+//
+// The frontier holds all the distinct states reachable after the target lines
+// seen so far, see starts, with the number of ways of reaching each. The
+// states whose pair of lines is not live are dropped, see live.
+func (l *lines) count(t []uint64) *big.Int {
+	n := len(t)
+	live := l.live(t)
+	rv := new(big.Int)
+	counts := map[uint64]*big.Int{}
+	for _, state := range l.starts() {
+		if _, pair := l.unanchor(state); live[0][pair] {
+			counts[state] = big.NewInt(1)
+		}
+	}
+	for k := 0; k+1 < n; k++ {
+		next := map[uint64]*big.Int{}
+		for state, count := range counts {
+			_, pair := l.unanchor(state)
+			_, b := l.unpair(pair)
+			for _, c := range l.successors(pair, t[k]) {
+				if !live[k+1][l.pair(b, c)] {
+					continue
+				}
+				s := l.next(state, c)
+				sum, ok := next[s]
+				if !ok {
+					sum = new(big.Int)
+					next[s] = sum
+				}
+				sum.Add(sum, count)
+			}
+		}
+		if len(next) == 0 {
+			return rv
+		}
+		counts = next
+	}
+	for state, count := range counts {
+		if l.closes(t, state) {
+			rv.Add(rv, count)
+		}
+	}
+	return rv
+}
+
+// Count returns the exact number of parents of the target.
+//
+// The parents are counted with the transfer matrix of Rows, without building
+// any of them, so the count may be astronomically large. Unlike Rows, Count
+// keeps the whole frontier, so the more parents, the slower it is. It has the same
+// limits as Rows: the lines of the grid must be at most MaxRowsLineLength
+// long, or MaxRowsGluedLineLength if the y edges are glued, and the topology
+// must be supported. The count is zero iff the target
+// is a Garden of Eden.
+func Count(target *grid.Grid) (*big.Int, error) {
+	l, t, _, err := prepare(target)
+	if err != nil {
+		return nil, err
+	}
+	return l.count(t), nil
+}
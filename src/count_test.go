@@ -0,0 +1,149 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package solver
+
+import (
+	"testing"
+)
+
+func TestCount(t *testing.T) {
+	for _, td := range []struct {
+		name   string
+		target string
+	}{
+		{
+			name: "three parents",
+			target: `8x8
+#+##++##
+#++++##+
+#++##+#+
++##+#+++
+++###+##
+++++###+
+++++##++
+#+++##++
+`,
+		},
+		{
+			name: "two parents",
+			target: `8x8
+#+#+++++
+++#++#+#
++##++++#
++###+++#
+++#+##+#
+##+++##+
+##+#++#+
++++#++#+
+`,
+		},
+		{
+			name: "wide",
+			target: `16x8
+#+##++###+##++##
+#++++##+#++++##+
+#++##+#+#++##+#+
++##+#++++##+#+++
+++###+##++###+##
+++++###+++++###+
+++++##++++++##++
+#+++##++#+++##++
+`,
+		},
+		{
+			name: "plane",
+			target: `8x8 plane
+#+##++##
+#++++##+
+#++##+#+
++##+#+++
+++###+##
+++++###+
+++++##++
+#+++##++
+`,
+		},
+		{
+			name: "klein bottle",
+			target: `8x8 klein
+#+##++##
+#++++##+
+#++##+#+
++##+#+++
+++###+##
+++++###+
+++++##++
+#+++##++
+`,
+		},
+		{
+			name: "wide cylinder",
+			target: `16x8 cylinder
+#+##++###+##++##
+#++++##+#++++##+
+#++##+#+#++##+#+
++##+#++++##+#+++
+++###+##++###+##
+++++###+++++###+
+++++##++++++##++
+#+++##++#+++##++
+`,
+		},
+		{
+			name: "orphan",
+			target: `8x8
+########
+########
+########
+########
+########
+########
+########
+########
+`,
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			target := parseGrid(td.target, t)
+			got, err := Count(target)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			e, err := Enumerate(target, 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for {
+				parent, err := e.Next()
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if parent == nil {
+					break
+				}
+			}
+			if !got.IsInt64() || got.Int64() != int64(e.Count()) {
+				t.Errorf("want %d parents, got %v", e.Count(), got)
+			}
+			parent, err := Rows{}.Solve(target)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if orphan := got.Sign() == 0; orphan != (parent == nil) {
+				t.Errorf("count is %v, but Rows returned:\n%v", got, parent)
+			}
+		})
+	}
+}
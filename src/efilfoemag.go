@@ -17,8 +17,18 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+
+	"github.com/pawelz/efilfoemag/src/cnf"
+	"github.com/pawelz/efilfoemag/src/grid"
+	"github.com/pawelz/efilfoemag/src/ltl"
+	"github.com/pawelz/efilfoemag/src/neighborhood"
+	"github.com/pawelz/efilfoemag/src/solver"
+	"github.com/pawelz/efilfoemag/src/state"
 )
 
 const (
@@ -26,34 +36,479 @@ const (
 )
 
 var (
-	inputFileName = flag.String("input", "", fmt.Sprintf("Path to the input .elif file. Must be smaller than %dB.", inputCap))
-	// outputDir = flag.String("output", "", "Path to the output directory. Must not exist.")
+	inputFileName  = flag.String("input", "", fmt.Sprintf("Path to the input .elif file. Must be smaller than %dB.", inputCap))
+	outputDir      = flag.String("output", "", "Path to the output directory. Must not exist.")
+	enumerate      = flag.Bool("enumerate", false, "If set, write all the parents to --output as numbered .efil files, instead of printing one.")
+	limit          = flag.Int("limit", 0, "If positive, --enumerate writes at most this many parents.")
+	optimize       = flag.String("optimize", "", "If set to min or max, find a parent with the fewest or the most living cells.")
+	proofFileName  = flag.String("proof", "", "If set together with --optimize, write the proof of optimality to this path in the DIMACS CNF format.")
+	certificate    = flag.String("certificate", "", "If set and the target is a Garden of Eden, write a minimal orphan pattern to this path.")
+	generations    = flag.Int("generations", 0, "If positive, search for this many generations of ancestors and print the deepest chain found, oldest first.")
+	count          = flag.Bool("count", false, "If set, print the exact number of parents instead of finding one.")
+	dimacsFileName = flag.String("dimacs", "", "If set, write the predecessor problem to this path in the DIMACS CNF format instead of solving it.")
+	varMapFileName = flag.String("varmap", "", "If set together with --dimacs, write the map of the DIMACS variables to the parent cells to this path.")
+	strategyName   = flag.String("strategy", "backtrack", fmt.Sprintf("The method of searching for parents, one of %v.", solver.StrategyNames()))
+	modelFileName  = flag.String("model", "", "If set, decode the parent from the output of an external SAT solver run on the --dimacs file, instead of solving.")
+	unbounded      = flag.Bool("unbounded", false, "If set, search for a parent on the unbounded plane, with all the cells outside of the input dead. The parent may spill into a margin around it.")
+	maxMargin      = flag.Int("max-margin", 11, "The largest margin searched with --unbounded.")
+	ruleName       = flag.String("rule", "", "If set, the rule of the game in the B/S notation, e.g. B36/S23, or in the Hensel notation, e.g. B2-a/S12, or a Generations rule, e.g. B2/S/C3, or a Larger than Life rule, e.g. R5,C0,M1,S34..58,B34..45,NM. Conway's B3/S23 by default. Any rule can be given as a MAP rulestring.")
+	ruleTable      = flag.String("rule-table", "", fmt.Sprintf("If set, path to the raw %d-byte table of the rule. Bit n of the table, from the most significant bit of the first byte, tells whether the neighborhood n evolves into a living cell.", neighborhood.TableSize))
+	topologyName   = flag.String("topology", "", fmt.Sprintf("If set, overrides the topology named in the input file, one of %v.", grid.TopologyNames()))
+	parentSymmetry = flag.String("parent-symmetry", "", fmt.Sprintf("If set, only search for the parents invariant under this symmetry, one of %v.", grid.SymmetryNames()))
 )
 
+// writeDIMACS writes the predecessor problem of the target, encoded as the formula, for external SAT solvers.
+func writeDIMACS(f *cnf.Formula, target *grid.Grid) {
+	dimacsFile, err := os.Create(*dimacsFileName)
+	if err != nil {
+		log.Fatalf("Failed to create %q: %v.", *dimacsFileName, err)
+	}
+	defer dimacsFile.Close()
+	if err := f.WriteDIMACS(dimacsFile); err != nil {
+		log.Fatalf("Failed to write %q: %v.", *dimacsFileName, err)
+	}
+	if *varMapFileName == "" {
+		return
+	}
+	varMapFile, err := os.Create(*varMapFileName)
+	if err != nil {
+		log.Fatalf("Failed to create %q: %v.", *varMapFileName, err)
+	}
+	defer varMapFile.Close()
+	if err := cnf.WriteVarMap(varMapFile, target.Width(), target.Height()); err != nil {
+		log.Fatalf("Failed to write %q: %v.", *varMapFileName, err)
+	}
+}
+
+// solveLtL prints a parent of the target under the Larger than Life rule.
+//
+// The parent is found with the built-in SAT solver, or with an external one
+// through --dimacs and --model. The other modes are not supported.
+func solveLtL(target *grid.Grid, r *ltl.Rule) {
+	if *count || *unbounded || *generations > 0 || *optimize != "" || *enumerate || *certificate != "" || *parentSymmetry != "" {
+		log.Fatalf("The Larger than Life rules only support finding a parent, optionally with --dimacs or --model.")
+	}
+	var parent *grid.Grid
+	if *dimacsFileName == "" && *modelFileName == "" {
+		var err error
+		if parent, err = ltl.Solve(target, r); err != nil {
+			log.Fatalf("Failed to solve %q: %v.", *inputFileName, err)
+		}
+	} else {
+		f, err := ltl.Encode(target, r)
+		if err != nil {
+			log.Fatalf("Failed to encode %q: %v.", *inputFileName, err)
+		}
+		if *dimacsFileName != "" {
+			writeDIMACS(f, target)
+			return
+		}
+		output, err := ioutil.ReadFile(*modelFileName)
+		if err != nil {
+			log.Fatalf("Failed to read the model file %q: %v.", *modelFileName, err)
+		}
+		if parent, err = cnf.DecodeModelOf(output, target.Width(), target.Height(), f.NumVars); err != nil {
+			log.Fatalf("Failed to decode the model file %q: %v.", *modelFileName, err)
+		}
+	}
+	if parent == nil {
+		fmt.Printf("%q is a Garden of Eden: it has no parents.\n", *inputFileName)
+		return
+	}
+	if err := ltl.Check(parent, target, r); err != nil {
+		log.Fatalf("The parent found for %q is invalid: %v.", *inputFileName, err)
+	}
+	os.Stdout.Write(parent.ToEfil())
+}
+
+// checkStates verifies that the target only has the states of its rule.
+func checkStates(target *grid.Grid) error {
+	for y := uint(0); y < target.Height(); y++ {
+		for x := uint(0); x < target.Width(); x++ {
+			s, err := target.Get(x, y)
+			if err != nil {
+				return err
+			}
+			if int(s) >= target.Rule().States() {
+				return fmt.Errorf("cell (%d, %d) is %s, but the %s rule has %d states", x, y, s.ToStr(), target.Rule(), target.Rule().States())
+			}
+		}
+	}
+	return nil
+}
+
+// findParent returns a parent of the target, or nil if the target is a Garden of Eden.
+//
+// Unless the symmetry is nil, the parent is invariant under it, and nil means
+// that there is no such parent.
+func findParent(target *grid.Grid, symmetry *grid.Symmetry) *grid.Grid {
+	if *modelFileName != "" {
+		output, err := ioutil.ReadFile(*modelFileName)
+		if err != nil {
+			log.Fatalf("Failed to read the model file %q: %v.", *modelFileName, err)
+		}
+		parent, err := cnf.DecodeModel(output, target.Width(), target.Height())
+		if err != nil {
+			log.Fatalf("Failed to decode the model file %q: %v.", *modelFileName, err)
+		}
+		if parent != nil {
+			parent.SetTopology(target.Topology())
+			parent.SetRule(target.Rule())
+			if err := solver.FillDying(parent, target); err != nil {
+				log.Fatalf("Failed to decode the model file %q: %v.", *modelFileName, err)
+			}
+		}
+		return parent
+	}
+	strategy, err := solver.StrategyByName(*strategyName)
+	if err != nil {
+		log.Fatalf("Invalid --strategy: %v.", err)
+	}
+	var parent *grid.Grid
+	if symmetry == nil {
+		parent, err = strategy.Solve(target)
+	} else if s, ok := strategy.(solver.SymmetricStrategy); ok {
+		parent, err = s.SolveSymmetric(target, symmetry)
+	} else {
+		log.Fatalf("The %q strategy does not support --parent-symmetry.", *strategyName)
+	}
+	if err != nil {
+		log.Fatalf("Failed to solve %q: %v.", *inputFileName, err)
+	}
+	return parent
+}
+
+// optimizeParent prints a parent of the target with the fewest or the most living cells.
+func optimizeParent(target *grid.Grid) {
+	objective, err := solver.ObjectiveByName(*optimize)
+	if err != nil {
+		log.Fatalf("Invalid --optimize: %v.", err)
+	}
+	search := objective
+	if target.Rule().ParentBackground().IsAlive() {
+		// The living cells of the parent are dead relative to its background.
+		search = solver.MaxPopulation
+		if objective == solver.MaxPopulation {
+			search = solver.MinPopulation
+		}
+	}
+	o, err := solver.Optimize(target, search)
+	if err != nil {
+		log.Fatalf("Failed to optimize %q: %v.", *inputFileName, err)
+	}
+	if *proofFileName != "" {
+		proofFile, err := os.Create(*proofFileName)
+		if err != nil {
+			log.Fatalf("Failed to create %q: %v.", *proofFileName, err)
+		}
+		defer proofFile.Close()
+		if err := o.Proof.WriteDIMACS(proofFile); err != nil {
+			log.Fatalf("Failed to write %q: %v.", *proofFileName, err)
+		}
+	}
+	if o.Parent == nil {
+		fmt.Printf("%q is a Garden of Eden: it has no parents.\n", *inputFileName)
+		return
+	}
+	if err := solver.Check(o.Parent, target); err != nil {
+		log.Fatalf("The parent found for %q is invalid: %v.", *inputFileName, err)
+	}
+	os.Stdout.Write(absolute(o.Parent, target).ToEfil())
+	than := "fewer"
+	if objective == solver.MaxPopulation {
+		than = "more"
+	}
+	population := o.Population
+	if search != objective {
+		population = int(target.Width()*target.Height()) - population
+	}
+	fmt.Fprintf(os.Stderr, "The parent has %d living cells. No parent has %s, see --proof.\n", population, than)
+}
+
+// solveUnbounded prints a parent of the target on the unbounded plane.
+func solveUnbounded(target *grid.Grid) {
+	u, err := solver.SolveUnbounded(target, *maxMargin)
+	if err != nil {
+		log.Fatalf("Failed to solve %q: %v.", *inputFileName, err)
+	}
+	if u.Orphan {
+		fmt.Printf("%q is a Garden of Eden: it has no parents on the plane, whatever the margin.\n", *inputFileName)
+		return
+	}
+	if u.Parent == nil {
+		fmt.Printf("%q has no parents within the margin of %d cells, but it is not proven to be a Garden of Eden.\n", *inputFileName, u.Margin)
+		return
+	}
+	if err := solver.Check(u.Parent, u.Target); err != nil {
+		log.Fatalf("The parent found for %q is invalid: %v.", *inputFileName, err)
+	}
+	os.Stdout.Write(absolute(u.Parent, u.Target).ToEfil())
+	fmt.Fprintf(os.Stderr, "The parent is padded with %d cells on every side. Its outermost ring is the same as the background.\n", u.Margin+1)
+}
+
+// writeCertificate writes the minimal orphan pattern of the target, relative to the given background.
+func writeCertificate(target *grid.Grid, background state.State) {
+	p, err := solver.MinimalOrphan(target)
+	if err != nil {
+		log.Fatalf("Failed to shrink %q: %v.", *inputFileName, err)
+	}
+	if p == nil {
+		log.Fatalf("Failed to shrink %q: it has parents after all.", *inputFileName)
+	}
+	if err := ioutil.WriteFile(*certificate, p.Absolute(background).ToEfil(), 0644); err != nil {
+		log.Fatalf("Failed to write %q: %v.", *certificate, err)
+	}
+	fmt.Printf("%d of its cells are enough, see %q.\n", p.NumFixed(), *certificate)
+}
+
+// printGenerations prints the deepest chain of ancestors of the target, relative to the given background.
+func printGenerations(target *grid.Grid, background state.State) {
+	chain, err := solver.Generations(target, *generations)
+	if err != nil {
+		log.Fatalf("Failed to search for the ancestors of %q: %v.", *inputFileName, err)
+	}
+	// Every generation is relative to the background of its own, which the
+	// rule evolving it tells.
+	rule := target.Rule()
+	chain[len(chain)-1] = target.Absolute(background)
+	for g := len(chain) - 2; g >= 0; g-- {
+		chain[g] = chain[g].Absolute(rule.ParentBackground())
+		if g == 0 {
+			break
+		}
+		if rule, err = rule.Previous(); err != nil {
+			log.Fatalf("Failed to search for the ancestors of %q: %v.", *inputFileName, err)
+		}
+	}
+	for g := 0; g+1 < len(chain); g++ {
+		if err := solver.Check(chain[g], chain[g+1]); err != nil {
+			log.Fatalf("The generation %d found for %q is invalid: %v.", g, *inputFileName, err)
+		}
+	}
+	for _, g := range chain {
+		os.Stdout.Write(g.ToEfil())
+		fmt.Println()
+	}
+	depth := len(chain) - 1
+	if depth < *generations {
+		fmt.Fprintf(os.Stderr, "The ancestors of %q die out after %d of %d generations.\n", *inputFileName, depth, *generations)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Found %d generations of ancestors of %q.\n", depth, *inputFileName)
+}
+
+// enumerateParents writes the parents of the target to the output directory.
+func enumerateParents(target *grid.Grid) {
+	if *outputDir == "" {
+		log.Fatalf("Missing flag --output, mandatory with --enumerate.")
+	}
+	if err := os.Mkdir(*outputDir, 0755); err != nil {
+		log.Fatalf("Failed to create the output directory %q: %v.", *outputDir, err)
+	}
+	e, err := solver.Enumerate(target, *limit)
+	if err != nil {
+		log.Fatalf("Failed to enumerate the parents of %q: %v.", *inputFileName, err)
+	}
+	for {
+		parent, err := e.Next()
+		if err != nil {
+			log.Fatalf("Failed to enumerate the parents of %q: %v.", *inputFileName, err)
+		}
+		if parent == nil {
+			break
+		}
+		if err := solver.Check(parent, target); err != nil {
+			log.Fatalf("The parent found for %q is invalid: %v.", *inputFileName, err)
+		}
+		name := filepath.Join(*outputDir, fmt.Sprintf("parent%06d.efil", e.Count()))
+		if err := ioutil.WriteFile(name, absolute(parent, target).ToEfil(), 0644); err != nil {
+			log.Fatalf("Failed to write %q: %v.", name, err)
+		}
+	}
+	if e.Count() == 0 {
+		fmt.Printf("%q is a Garden of Eden: it has no parents.\n", *inputFileName)
+		return
+	}
+	fmt.Printf("Wrote %d parents of %q to %q.\n", e.Count(), *inputFileName, *outputDir)
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if c, ok := commandByName(os.Args[1]); ok {
+			runCommand(c, os.Args[2:])
+			return
+		}
+	}
 	flag.Parse()
 	if a := flag.Args(); len(flag.Args()) != 0 {
 		log.Fatalf("Invalid non-flag arguments %v.\n", a)
 	}
 
-	if *inputFileName != "" {
+	if *inputFileName == "" {
 		log.Fatalf("Missing mandatory flag --input.")
 	}
 
-	inputFile, err := os.Open(*inputFileName)
+	target, err := readGrid(*inputFileName)
 	if err != nil {
-		log.Fatalf("Failed to open the input file %q: %v.", *inputFileName, err)
+		log.Fatalf("Invalid --input: %v.", err)
+	}
+	if *topologyName != "" {
+		topology, err := grid.TopologyByName(*topologyName)
+		if err != nil {
+			log.Fatalf("Invalid --topology: %v.", err)
+		}
+		target.SetTopology(topology)
+	}
+	var ltlRule *ltl.Rule
+	if *ruleName != "" && ltl.IsRule(*ruleName) {
+		if ltlRule, err = ltl.ParseRule(*ruleName); err != nil {
+			log.Fatalf("Invalid --rule: %v.", err)
+		}
+	} else if *ruleName != "" {
+		rule, err := neighborhood.ParseRule(*ruleName)
+		if err != nil {
+			log.Fatalf("Invalid --rule: %v.", err)
+		}
+		target.SetRule(rule)
+	}
+	if *ruleTable != "" {
+		if *ruleName != "" {
+			log.Fatalf("Flags --rule and --rule-table are mutually exclusive.")
+		}
+		table, err := ioutil.ReadFile(*ruleTable)
+		if err != nil {
+			log.Fatalf("Failed to read the rule table %q: %v.", *ruleTable, err)
+		}
+		rule, err := neighborhood.ParseTable(table)
+		if err != nil {
+			log.Fatalf("Invalid --rule-table: %v.", err)
+		}
+		target.SetRule(rule)
+	}
+	if err := checkStates(target); err != nil {
+		log.Fatalf("Invalid %q: %v.", *inputFileName, err)
+	}
+
+	if ltlRule != nil {
+		solveLtL(target, ltlRule)
+		return
 	}
-	defer inputFile.Close()
 
-	inputData := make([]byte, 10240)
-	bytesRead, err := inputFile.Read(inputData)
+	// The searches see the target relative to its background, see
+	// grid.Grid.Relative, and the parents found are printed in absolute terms.
+	background := target.Background()
+	if target, err = target.Relative(); err != nil {
+		log.Fatalf("Invalid %q: %v.", *inputFileName, err)
+	}
+
+	var symmetry *grid.Symmetry
+	if *parentSymmetry != "" {
+		if *count || *unbounded || *generations > 0 || *optimize != "" || *enumerate || *certificate != "" {
+			log.Fatalf("Flag --parent-symmetry only works with the search for a parent, optionally with --dimacs or --model.")
+		}
+		if symmetry, err = grid.SymmetryByName(*parentSymmetry); err != nil {
+			log.Fatalf("Invalid --parent-symmetry: %v.", err)
+		}
+		if err := symmetry.Check(target); err != nil {
+			log.Fatalf("Invalid --parent-symmetry for %q: %v.", *inputFileName, err)
+		}
+	}
+
+	if *dimacsFileName != "" {
+		f, err := cnf.Encode(target)
+		if symmetry != nil {
+			f, err = cnf.EncodeSymmetric(target, symmetry)
+		}
+		if err != nil {
+			log.Fatalf("Failed to encode %q: %v.", *inputFileName, err)
+		}
+		writeDIMACS(f, target)
+		return
+	}
+
+	if *count {
+		n, err := solver.Count(target)
+		if err != nil {
+			log.Fatalf("Failed to count the parents of %q: %v.", *inputFileName, err)
+		}
+		fmt.Printf("%q has %v parents.\n", *inputFileName, n)
+		return
+	}
+
+	if *unbounded {
+		solveUnbounded(target)
+		return
+	}
+
+	if *generations > 0 {
+		printGenerations(target, background)
+		return
+	}
+
+	if *optimize != "" {
+		optimizeParent(target)
+		return
+	}
+
+	if *enumerate {
+		enumerateParents(target)
+		return
+	}
+
+	parent := findParent(target, symmetry)
+	if parent == nil && symmetry != nil {
+		fmt.Printf("%q has no parents invariant under %s.\n", *inputFileName, symmetry)
+		return
+	}
+	if parent == nil {
+		fmt.Printf("%q is a Garden of Eden: it has no parents.\n", *inputFileName)
+		if *certificate != "" {
+			writeCertificate(target, background)
+		}
+		return
+	}
+	if err := solver.Check(parent, target); err != nil {
+		log.Fatalf("The parent found for %q is invalid: %v.", *inputFileName, err)
+	}
+	if symmetry != nil {
+		if err := symmetry.Check(parent); err != nil {
+			log.Fatalf("The parent found for %q is invalid: %v.", *inputFileName, err)
+		}
+	}
+	os.Stdout.Write(absolute(parent, target).ToEfil())
+}
+
+// readGrid reads the grid from the efil file of the given name, or from the standard input if the name is "-".
+func readGrid(name string) (*grid.Grid, error) {
+	inputFile := os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open %q: %v", name, err)
+		}
+		defer f.Close()
+		inputFile = f
+	}
+
+	inputData, err := ioutil.ReadAll(io.LimitReader(inputFile, inputCap))
 	if err != nil {
-		log.Fatalf("Failed to read the input file %q: %v.", *inputFileName, err)
+		return nil, fmt.Errorf("cannot read %q: %v", name, err)
+	}
+	if len(inputData) == inputCap {
+		return nil, fmt.Errorf("%q is too large, must be smaller than %dB", name, inputCap)
 	}
-	if bytesRead == inputCap {
-		log.Fatalf("The input file %q is too large. Must be smaller than %dB.", inputCap)
+
+	g, err := grid.Parse(inputData)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %q: %v", name, err)
 	}
+	return g, nil
+}
 
-	//c = grid.Parse(inputData)
+// absolute returns the parent found for the target relative to its background in the terms of its cells, see grid.Grid.Relative.
+//
+// The parent is relative to the background of the parents, which the rule of
+// the target tells.
+func absolute(parent, target *grid.Grid) *grid.Grid {
+	return parent.Absolute(target.Rule().ParentBackground())
 }
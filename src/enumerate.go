@@ -0,0 +1,97 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package solver
+
+import (
+	"fmt"
+
+	"github.com/pawelz/efilfoemag/src/cnf"
+	"github.com/pawelz/efilfoemag/src/grid"
+	"github.com/pawelz/efilfoemag/src/sat"
+)
+
+// Enumerator yields the parents of a target one at a time, see Enumerate.
+type Enumerator struct {
+	solver *sat.Solver
+	target *grid.Grid
+	width  uint
+	height uint
+	limit  int
+	count  int
+	done   bool
+}
+
+// Enumerate returns an Enumerator of all the parents of the target.
+//
+// At most limit parents are yielded, or all of them if limit is not positive.
+// The parents are found with the built-in SAT solver. Every parent found is
+// excluded from the further search with a clause, so no parent is ever yielded
+// twice. The rules with dying states are not supported, as their dead cells
+// may have several parent states each.
+func Enumerate(target *grid.Grid, limit int) (*Enumerator, error) {
+	if target.Rule().States() > 2 {
+		return nil, fmt.Errorf("the %s rule has dying states, which are not supported", target.Rule())
+	}
+	s, ok, err := newSATSolver(target, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Enumerator{
+		solver: s,
+		target: target,
+		width:  target.Width(),
+		height: target.Height(),
+		limit:  limit,
+		done:   !ok,
+	}, nil
+}
+
+// Next returns the next parent, or nil and no error if there are no more.
+func (e *Enumerator) Next() (*grid.Grid, error) {
+	if e.done || e.limit > 0 && e.count >= e.limit {
+		return nil, nil
+	}
+	if !e.solver.Solve() {
+		e.done = true
+		return nil, nil
+	}
+	parent, err := satParent(e.solver, e.target)
+	if err != nil {
+		return nil, err
+	}
+	e.count++
+	// The clause is satisfied by every assignment except the one just found.
+	block := make([]int, 0, e.width*e.height)
+	for y := uint(0); y < e.height; y++ {
+		for x := uint(0); x < e.width; x++ {
+			v := cnf.Var(e.width, x, y)
+			if e.solver.Value(v) {
+				v = -v
+			}
+			block = append(block, v)
+		}
+	}
+	ok, err := e.solver.AddClause(block)
+	if err != nil {
+		return nil, fmt.Errorf("cannot exclude the parent: %v", err)
+	}
+	e.done = !ok
+	return parent, nil
+}
+
+// Count returns the number of parents yielded so far.
+func (e *Enumerator) Count() int {
+	return e.count
+}
@@ -0,0 +1,101 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package solver
+
+import (
+	"testing"
+)
+
+func TestEnumerate(t *testing.T) {
+	for _, td := range []struct {
+		name   string
+		target string
+		limit  int
+		want   int
+	}{
+		{
+			name: "three parents",
+			target: `8x8
+#+##++##
+#++++##+
+#++##+#+
++##+#+++
+++###+##
+++++###+
+++++##++
+#+++##++
+`,
+			want: 3,
+		},
+		{
+			name: "limit",
+			target: `8x8
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+`,
+			limit: 5,
+			want:  5,
+		},
+		{
+			name: "orphan",
+			target: `8x8
+########
+########
+########
+########
+########
+########
+########
+########
+`,
+			limit: 5,
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			target := parseGrid(td.target, t)
+			e, err := Enumerate(target, td.limit)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			seen := map[string]bool{}
+			for {
+				parent, err := e.Next()
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if parent == nil {
+					break
+				}
+				if err := Check(parent, target); err != nil {
+					t.Errorf("invalid parent:\n%s\n%v", parent.ToEfil(), err)
+				}
+				if efil := string(parent.ToEfil()); seen[efil] {
+					t.Errorf("parent yielded twice:\n%s", efil)
+				} else {
+					seen[efil] = true
+				}
+			}
+			if e.Count() != td.want {
+				t.Errorf("want %d parents, got %d", td.want, e.Count())
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package solver
+
+import (
+	"fmt"
+
+	"github.com/pawelz/efilfoemag/src/cnf"
+	"github.com/pawelz/efilfoemag/src/grid"
+	"github.com/pawelz/efilfoemag/src/sat"
+	"github.com/pawelz/efilfoemag/src/state"
+)
+
+// ancestors returns a chain of k generations of ancestors of the target, or nil if there is none.
+func ancestors(target *grid.Grid, k int) ([]*grid.Grid, error) {
+	f, err := cnf.EncodeGenerations(target, k)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode the target: %v", err)
+	}
+	s := sat.New(f.NumVars)
+	for _, clause := range f.Clauses {
+		if _, err := s.AddClause(clause); err != nil {
+			return nil, fmt.Errorf("cannot add a clause: %v", err)
+		}
+	}
+	if !s.Solve() {
+		return nil, nil
+	}
+	w, h := target.Width(), target.Height()
+	rv := make([]*grid.Grid, k)
+	for g := range rv {
+		rv[g] = target.Blank()
+		for y := uint(0); y < h; y++ {
+			for x := uint(0); x < w; x++ {
+				if err := rv[g].Set(x, y, state.Of(s.Value(cnf.GenerationVar(w, h, g, x, y)))); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return rv, nil
+}
+
+// Generations searches for up to k generations of ancestors of the target.
+//
+// It returns the longest chain of grids found, oldest first, in which every
+// grid evolves into the next one and the last one is the target. So a chain of
+// length k+1 means that the target has k generations of ancestors, and a
+// shorter one means that every chain of ancestors dies out sooner: the oldest
+// grid of the returned chain is an ancestor as deep as they go. The chains are
+// searched for with the built-in SAT solver, one more generation at a time, so
+// the proof that no chain is longer is exact. The rules with dying states are
+// not supported.
+func Generations(target *grid.Grid, k int) ([]*grid.Grid, error) {
+	if target.Rule().States() > 2 {
+		return nil, fmt.Errorf("the %s rule has dying states, which are not supported", target.Rule())
+	}
+	chain := []*grid.Grid{target}
+	for depth := 1; depth <= k; depth++ {
+		found, err := ancestors(target, depth)
+		if err != nil {
+			return nil, err
+		}
+		if found == nil {
+			break
+		}
+		chain = append(found, target)
+	}
+	return chain, nil
+}
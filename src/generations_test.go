@@ -0,0 +1,93 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package solver
+
+import (
+	"testing"
+)
+
+func TestGenerations(t *testing.T) {
+	for _, td := range []struct {
+		name   string
+		target string
+		k      int
+		want   int
+	}{
+		{
+			name: "glider",
+			target: `8x8
+++++++++
++++#++++
+++++#+++
+++###+++
+++++++++
+++++++++
+++++++++
+++++++++
+`,
+			k:    2,
+			want: 2,
+		},
+		{
+			name: "no grandparents",
+			target: `8x8
+#+##++##
+#++++##+
+#++##+#+
++##+#+++
+++###+##
+++++###+
+++++##++
+#+++##++
+`,
+			k:    3,
+			want: 1,
+		},
+		{
+			name: "orphan",
+			target: `8x8
+########
+########
+########
+########
+########
+########
+########
+########
+`,
+			k:    2,
+			want: 0,
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			target := parseGrid(td.target, t)
+			chain, err := Generations(target, td.k)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := len(chain) - 1; got != td.want {
+				t.Errorf("want %d generations, got %d", td.want, got)
+			}
+			if last := chain[len(chain)-1]; !last.EqualsTo(target) {
+				t.Errorf("want the chain to end with the target, got:\n%s", last.ToEfil())
+			}
+			for g := 0; g+1 < len(chain); g++ {
+				if err := Check(chain[g], chain[g+1]); err != nil {
+					t.Errorf("generation %d does not evolve into the next one:\n%s\n%v", g, chain[g].ToEfil(), err)
+				}
+			}
+		})
+	}
+}
@@ -19,19 +19,36 @@ import (
 	"bytes"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/pawelz/efilfoemag/src/bits"
+	"github.com/pawelz/efilfoemag/src/neighborhood"
 	"github.com/pawelz/efilfoemag/src/state"
 )
 
 const (
 	endl = byte('\n')
+	// aliveBackground ends the header line of the grids whose Background is alive.
+	aliveBackground = "alive"
 )
 
 type Grid struct {
 	width  uint
 	height uint
-	b      []uint8
+	// b holds the living cells, one bit per cell. Every row starts at a
+	// new byte, see Row, and the bits beyond the width are 0.
+	b []uint8
+	// dying holds the dying states of the Generations rules, one byte per
+	// cell in the row-major order, and 0 for the other cells. It is nil as
+	// long as there are no dying cells.
+	dying []uint8
+	// topology is nil for the default Torus.
+	topology Topology
+	// rule is nil for the default neighborhood.Conway.
+	rule *neighborhood.Rule
+	// background is the state of the cells beyond the dead edges of the
+	// topology, see Background.
+	background state.State
 }
 
 // create is a factory of blank Grid objects.
@@ -39,19 +56,18 @@ func create(width, height int) (*Grid, error) {
 	if width <= 0 || height <= 0 {
 		return nil, fmt.Errorf("width and height of a Grid must be positive, got: width = %d, height = %d", width, height)
 	}
-	if w, h := width%8, height%8; w != 0 || h != 0 {
-		return nil, fmt.Errorf("width and height of a Grid must be divisible by 8, got width = %d (mod 8 = %d), height = %d (mod 8 = %d)", width, w, height, h)
-	}
-	if width < 8 || height < 8 {
-		return nil, fmt.Errorf("width and height of a Grid must be greater or equal 8, got width = %d, height = %d", width, height)
-	}
 	return &Grid{
 		width:  uint(width),
 		height: uint(height),
-		b:      make([]uint8, width*height/8),
+		b:      make([]uint8, (width+7)/8*height),
 	}, nil
 }
 
+// New returns a blank Grid of the given size. All cells of the new grid are dead.
+func New(width, height int) (*Grid, error) {
+	return create(width, height)
+}
+
 func stripFinalChar(s string) string {
 	if s == "" {
 		return ""
@@ -61,61 +77,97 @@ func stripFinalChar(s string) string {
 
 // Parse parses the content of .efil file to produce a Grid object.
 func Parse(inputData []byte) (*Grid, error) {
+	grid, _, err := parse(inputData, false)
+	return grid, err
+}
+
+// parse parses the content of .efil file.
+//
+// If dontCare is true, cells may also be rendered as DontCare. Along with the
+// Grid it returns another one, in which the cells with fixed states are alive.
+func parse(inputData []byte, dontCare bool) (*Grid, *Grid, error) {
 	r := bufio.NewReader(bytes.NewReader(inputData))
 	widthString, err := r.ReadString(byte('x'))
 	if err != nil {
-		return nil, fmt.Errorf("error reading width: %v", err)
+		return nil, nil, fmt.Errorf("error reading width: %v", err)
 	}
 	widthString = stripFinalChar(widthString)
 	heightString, err := r.ReadString(endl)
 	if err != nil {
-		return nil, fmt.Errorf("error reading height: %v", err)
+		return nil, nil, fmt.Errorf("error reading height: %v", err)
 	}
 	heightString = stripFinalChar(heightString)
+	var topology Topology
+	background := state.Dead
+	if fields := strings.Split(heightString, " "); len(fields) > 1 {
+		heightString = fields[0]
+		if fields[len(fields)-1] == aliveBackground {
+			background = state.Alive
+			fields = fields[:len(fields)-1]
+		}
+		if len(fields) > 2 {
+			return nil, nil, fmt.Errorf("error parsing header: want the size, optionally followed by the topology and %q, got %q", aliveBackground, fields[1:])
+		}
+		if len(fields) == 2 {
+			if topology, err = TopologyByName(fields[1]); err != nil {
+				return nil, nil, fmt.Errorf("error parsing topology: %v", err)
+			}
+		}
+	}
 	width, err := strconv.Atoi(widthString)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing width %q: %v", widthString, err)
+		return nil, nil, fmt.Errorf("error parsing width %q: %v", widthString, err)
 	}
 	height, err := strconv.Atoi(heightString)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing height %q: %v", heightString, err)
+		return nil, nil, fmt.Errorf("error parsing height %q: %v", heightString, err)
 	}
 
 	grid, err := create(width, height)
 	if err != nil {
-		return nil, fmt.Errorf("error creating grid: %v", err)
+		return nil, nil, fmt.Errorf("error creating grid: %v", err)
 	}
+	fixed, _ := create(width, height)
+	grid.topology = topology
+	grid.background = background
 
 	for rowNum := 0; rowNum < height; rowNum++ {
 		rowData, err := r.ReadBytes(endl)
 		if err != nil {
-			return nil, fmt.Errorf("error creating grid while reading row %d: %v", rowNum, err)
+			return nil, nil, fmt.Errorf("error creating grid while reading row %d: %v", rowNum, err)
 		}
 		if l := len(rowData); l != width+1 {
-			return nil, fmt.Errorf("error reading row %d, want %d characters (including \\n), got %d", rowNum, width+1, l)
+			return nil, nil, fmt.Errorf("error reading row %d, want %d characters (including \\n), got %d", rowNum, width+1, l)
 		}
-		for oNum := 0; oNum*8 < width; oNum++ {
-			var octet uint8
-			for bitNum := 0; bitNum < 8; bitNum++ {
-				symbol := rowData[oNum*8+bitNum]
-				switch symbol {
-				case '#':
-					octet |= (bits.Byte("10000000") >> bitNum)
-				case '+':
-					// pass
-				default:
-					return nil, fmt.Errorf("encountered invalid byte %c at (%d, %d)", symbol, rowNum, oNum*8+bitNum)
-				}
+		for x := uint(0); x < uint(width); x++ {
+			y := uint(rowNum)
+			switch symbol := rowData[x]; {
+			case symbol == '#':
+				grid.b[grid.byteshift(x, y)] |= bitmask(x)
+			case symbol == '+':
+				// pass
+			case symbol >= 'A' && symbol <= 'Z':
+				s, _ := state.OfRune(rune(symbol))
+				grid.setDying(x, y, s)
+			case symbol == DontCare && dontCare:
+				continue
+			default:
+				return nil, nil, fmt.Errorf("encountered invalid byte %c at (%d, %d)", symbol, rowNum, x)
 			}
-			grid.b[rowNum*width/8+oNum] = octet
+			fixed.b[fixed.byteshift(x, y)] |= bitmask(x)
 		}
 	}
 
-	return grid, nil
+	return grid, fixed, nil
+}
+
+// rowBytes returns the number of bytes storing every row.
+func (c *Grid) rowBytes() uint {
+	return (c.width + 7) / 8
 }
 
 func (c *Grid) byteshift(x, y uint) uint {
-	return y*c.width/8 + x/8
+	return y*c.rowBytes() + x/8
 }
 
 func bitmask(x uint) uint8 {
@@ -138,49 +190,302 @@ func (c *Grid) Get(x, y uint) (state.State, error) {
 	if octet&bitmask(x) != uint8(0) {
 		return state.Alive, nil
 	}
+	if c.dying != nil {
+		return state.State(c.dying[y*c.width+x]), nil
+	}
 	return state.Dead, nil
 }
 
-// torusGet returns the state of the cell at the given address assuming torus topology.
+// topologyGet returns the state of the cell at the given address, which may be out of range.
+//
+// Addresses out of range are resolved with the topology of the grid. Cells
+// outside of the grid are the Background.
+func (c *Grid) topologyGet(x, y int) (state.State, error) {
+	rx, ry, ok := c.Topology().Resolve(x, y, c.width, c.height)
+	if !ok {
+		return c.background, nil
+	}
+	return c.Get(rx, ry)
+}
+
+// Topology returns the topology of the grid.
+func (c *Grid) Topology() Topology {
+	if c.topology == nil {
+		return Torus
+	}
+	return c.topology
+}
+
+// SetTopology sets the topology of the grid.
+func (c *Grid) SetTopology(t Topology) {
+	c.topology = t
+}
+
+// Rule returns the rule of the grid.
+func (c *Grid) Rule() *neighborhood.Rule {
+	if c.rule == nil {
+		return neighborhood.Conway
+	}
+	return c.rule
+}
+
+// SetRule sets the rule of the grid.
+func (c *Grid) SetRule(r *neighborhood.Rule) {
+	c.rule = r
+}
+
+// Background returns the state of all the cells outside of the grid, beyond the dead edges of its topology.
+//
+// It is Dead unless the rule gives birth to cells with no living neighbours,
+// see neighborhood.Rule.NextBackground.
+func (c *Grid) Background() state.State {
+	return c.background
+}
+
+// SetBackground sets the state of all the cells outside of the grid, see Background.
+func (c *Grid) SetBackground(s state.State) {
+	c.background = s
+}
+
+// Blank returns a blank grid of the same size, topology, rule and background.
+func (c *Grid) Blank() *Grid {
+	return &Grid{
+		width:      c.width,
+		height:     c.height,
+		b:          make([]uint8, len(c.b)),
+		topology:   c.topology,
+		rule:       c.rule,
+		background: c.background,
+	}
+}
+
+// Relative returns the grid relative to its background, in which the parents are searched for.
 //
-// This method assumes the torus topology on the grid to resolve addresses
-// out of range. For performance and complexity reasons it can only resolve
-// addresses being one step out of range though.
-func (c *Grid) torusGet(x, y int) (state.State, error) {
-	if x == -1 {
-		x = int(c.width) - 1;
+// The cells of the result are alive iff they differ from the Background, which
+// is dead, and its rule is the one of the cells relative to the background of
+// the parents, see neighborhood.Rule.Relative. So the searches only ever see
+// the rules which do not give birth to cells with no living neighbours, and
+// the parents found are relative to their background, see Absolute. The grid
+// itself is returned if the background stays dead.
+func (c *Grid) Relative() (*Grid, error) {
+	rule := c.Rule()
+	parent, err := rule.PreviousBackground(c.background)
+	if err != nil {
+		return nil, err
 	}
-	if x == int(c.width) {
-		x = 0;
+	relative := rule.Relative(parent)
+	if relative == rule.Base() && !c.background.IsAlive() {
+		return c, nil
 	}
-	if y == -1 {
-		y = int(c.height) - 1;
+	if rule.States() > 2 {
+		return nil, fmt.Errorf("the %s rule has dying states, which are not supported with a background that is not dead", rule)
 	}
-	if y == int(c.height) {
-		y = 0;
+	rv := c.Absolute(c.background)
+	rv.rule = relative
+	rv.background = state.Dead
+	return rv, nil
+}
+
+// CheckRelative returns an error unless the grid is relative to its background, see Relative.
+//
+// The searches for parents assume that the cells beyond the edges stay dead:
+// that the Background is dead and that the rule never gives birth to cells
+// with no living neighbours. Relative turns any grid into one that is.
+func (c *Grid) CheckRelative() error {
+	if c.background != state.Dead {
+		return fmt.Errorf("the background is %s, want Dead, see Relative", c.background.ToStr())
 	}
-	return c.Get(uint(x), uint(y))
+	if c.Rule().Next(0).IsAlive() {
+		return fmt.Errorf("the %s rule gives birth to cells with no living neighbours, see Relative", c.Rule())
+	}
+	return nil
+}
+
+// Absolute returns the grid relative to the given background, see Relative, in the terms of its cells.
+//
+// The cells of the result are alive iff they differ from the background, which
+// becomes its Background, and its rule is the one the Relative rule is
+// derived from.
+func (c *Grid) Absolute(background state.State) *Grid {
+	rv := c.Copy()
+	rv.rule = c.Rule().Base()
+	rv.background = background
+	if background.IsAlive() {
+		for y := uint(0); y < rv.height; y++ {
+			for x := uint(0); x < rv.width; x++ {
+				rv.b[rv.byteshift(x, y)] ^= bitmask(x)
+			}
+		}
+	}
+	return rv
+}
+
+// Neighborhood returns the neighborhood of the cell at the given address.
+//
+// Cells of the neighborhood lying out of range are resolved with the topology
+// of the grid.
+func (c *Grid) Neighborhood(x, y uint) (neighborhood.Neighborhood, error) {
+	if err := c.validateAddress(x, y); err != nil {
+		return 0, fmt.Errorf("cannot get Neighborhood: %v", err)
+	}
+	var n neighborhood.Neighborhood
+	for _, side := range neighborhood.Sides() {
+		dx, dy := side.Offset()
+		s, err := c.topologyGet(int(x)+dx, int(y)+dy)
+		if err != nil {
+			return 0, fmt.Errorf("cannot get Neighborhood: %v", err)
+		}
+		n.Set(side, s)
+	}
+	return n, nil
 }
 
 // Set sets the state of the cell at the given address.
 func (c *Grid) Set(x, y uint, s state.State) error {
 	if err := c.validateAddress(x, y); err != nil {
-		return fmt.Errorf("cannot Get: %v", err)
+		return fmt.Errorf("cannot Set: %v", err)
 	}
-	c.b[c.byteshift(x, y)] |= bitmask(x)
+	if s.IsAlive() {
+		c.b[c.byteshift(x, y)] |= bitmask(x)
+	} else {
+		c.b[c.byteshift(x, y)] &^= bitmask(x)
+	}
+	c.setDying(x, y, s)
 	return nil
 }
 
+// setDying records the dying state of the cell at the given address, or clears it for the other states.
+func (c *Grid) setDying(x, y uint, s state.State) {
+	if c.dying == nil && s.IsDying() {
+		c.dying = make([]uint8, c.width*c.height)
+	}
+	if c.dying == nil {
+		return
+	}
+	if s.IsDying() {
+		c.dying[y*c.width+x] = uint8(s)
+	} else {
+		c.dying[y*c.width+x] = 0
+	}
+}
+
 // Width returns the width of the grid.
-func (c *Grid) Width(uint) {
+func (c *Grid) Width() uint {
 	return c.width
 }
 
 // Height returns the height of the grid.
-func (c *Grid) Height(uint) {
+func (c *Grid) Height() uint {
 	return c.height
 }
 
+// Row returns a copy of the bytes storing the living cells of the given row.
+//
+// The leftmost cell of the row is the most significant bit of the first byte.
+// Unless the width is a multiple of 8, the last byte is padded with 0 bits.
+func (c *Grid) Row(y uint) ([]uint8, error) {
+	if err := c.validateAddress(0, y); err != nil {
+		return nil, fmt.Errorf("cannot get Row: %v", err)
+	}
+	start := c.byteshift(0, y)
+	return append([]uint8{}, c.b[start:start+c.rowBytes()]...), nil
+}
+
+// Transpose returns a new grid mirrored along the NW-SE diagonal, so that its rows are the columns of this grid.
+//
+// The topology is copied as it is, so for the topologies treating the x and
+// y edges differently the result is not equivalent.
+func (c *Grid) Transpose() *Grid {
+	t := &Grid{
+		width:      c.height,
+		height:     c.width,
+		b:          make([]uint8, (c.height+7)/8*c.width),
+		topology:   c.topology,
+		rule:       c.rule,
+		background: c.background,
+	}
+	// The cells are transposed in blocks of 8x8, the bytes of 8 rows at a
+	// time, see transpose8.
+	for y := uint(0); y < c.height; y += 8 {
+		for x := uint(0); x < c.width; x += 8 {
+			var block uint64
+			for i := y; i < y+8; i++ {
+				block <<= 8
+				if i < c.height {
+					block |= uint64(c.b[c.byteshift(x, i)])
+				}
+			}
+			block = transpose8(block)
+			for i := x; i < x+8 && i < c.width; i++ {
+				t.b[t.byteshift(y, i)] = uint8(block >> (56 - 8*(i-x)))
+			}
+		}
+	}
+	if c.dying != nil {
+		for y := uint(0); y < c.height; y++ {
+			for x := uint(0); x < c.width; x++ {
+				t.setDying(y, x, state.State(c.dying[y*c.width+x]))
+			}
+		}
+	}
+	return t
+}
+
+// Copy returns a copy of the grid.
+func (c *Grid) Copy() *Grid {
+	return &Grid{
+		width:      c.width,
+		height:     c.height,
+		b:          append([]uint8{}, c.b...),
+		dying:      c.copyDying(),
+		topology:   c.topology,
+		rule:       c.rule,
+		background: c.background,
+	}
+}
+
+// copyDying returns a copy of the dying states, or nil if there are none.
+func (c *Grid) copyDying() []uint8 {
+	if c.dying == nil {
+		return nil
+	}
+	return append([]uint8{}, c.dying...)
+}
+
+// header returns the header line of the .efil format.
+//
+// The topology is only mentioned if it is not the default Torus, and the
+// background if it is alive.
+func (c *Grid) header() string {
+	rv := fmt.Sprintf("%dx%d", c.width, c.height)
+	if t := c.Topology(); t != Torus {
+		rv += " " + t.String()
+	}
+	if c.background.IsAlive() {
+		rv += " " + aliveBackground
+	}
+	return rv + "\n"
+}
+
+// ToEfil renders the grid in the .efil format.
+func (c *Grid) ToEfil() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(c.header())
+	for y := uint(0); y < c.height; y++ {
+		for x := uint(0); x < c.width; x++ {
+			s, _ := c.Get(x, y)
+			buf.WriteRune(s.ToRune())
+		}
+		buf.WriteByte(endl)
+	}
+	return buf.Bytes()
+}
+
+// EqualsTo returns true iff both grids have the same size and the same cells.
+func (c *Grid) EqualsTo(other *Grid) bool {
+	return c.equalsTo(other)
+}
+
 // equalsTo compares this grid to anover one.
 func (c *Grid) equalsTo(other *Grid) bool {
 	if c.height != other.height {
@@ -198,5 +503,16 @@ func (c *Grid) equalsTo(other *Grid) bool {
 			return false
 		}
 	}
+	if c.dying == nil && other.dying == nil {
+		return true
+	}
+	for y := uint(0); y < c.height; y++ {
+		for x := uint(0); x < c.width; x++ {
+			s, _ := c.Get(x, y)
+			if o, _ := other.Get(x, y); o != s {
+				return false
+			}
+		}
+	}
 	return true
 }
@@ -18,6 +18,8 @@ import (
 	"testing"
 
 	"github.com/pawelz/efilfoemag/src/bits"
+	"github.com/pawelz/efilfoemag/src/neighborhood"
+	"github.com/pawelz/efilfoemag/src/state"
 )
 
 func TestEqualsTo(t *testing.T) {
@@ -198,9 +200,81 @@ func TestParse(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "dying cells",
+			input: []byte(`8x8
+++++++++
++++#++++
+++#A#+++
++++B++++
+++++++++
+++++++++
+++++++++
++++++++Z
+`),
+			expected: &Grid{
+				width:  8,
+				height: 8,
+				b: []byte{
+					bits.Byte("00000000"),
+					bits.Byte("00010000"),
+					bits.Byte("00101000"),
+					bits.Byte("00000000"),
+					bits.Byte("00000000"),
+					bits.Byte("00000000"),
+					bits.Byte("00000000"),
+					bits.Byte("00000000"),
+				},
+				dying: func() []uint8 {
+					d := make([]uint8, 64)
+					d[2*8+3], d[3*8+3], d[7*8+7] = 2, 3, 27
+					return d
+				}(),
+			},
+		},
+		{
+			name: "odd size",
+			input: []byte(`10x3
+#++++++++#
+++++++++++
++#+#+#+#+#
+`),
+			expected: &Grid{
+				width:  10,
+				height: 3,
+				b: []byte{
+					bits.Byte("10000000"), bits.Byte("01000000"),
+					bits.Byte("00000000"), bits.Byte("00000000"),
+					bits.Byte("01010101"), bits.Byte("01000000"),
+				},
+			},
+		},
+		{
+			name:  "single cell",
+			input: []byte("1x1\n#\n"),
+			expected: &Grid{
+				width:  1,
+				height: 1,
+				b:      []byte{bits.Byte("10000000")},
+			},
+		},
+		{
+			name: "badSymbol",
+			input: []byte(`8x8
+++++++++
++++#++++
+++#a#+++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+`),
+			failure: true,
+		},
 		{
 			name: "badHeight",
-			input: []byte(`8x7
+			input: []byte(`8x9
 ++++++++
 +++#++++
 ++###+++
@@ -218,7 +292,7 @@ func TestParse(t *testing.T) {
 
 			if td.failure {
 				if err == nil {
-					t.Errorf("expected a failure, got %x", actual)
+					t.Errorf("expected a failure, got %v", actual)
 				}
 				return
 			}
@@ -228,7 +302,404 @@ func TestParse(t *testing.T) {
 			}
 
 			if !actual.equalsTo(td.expected) {
-				t.Errorf("expected %x, got %x", td.expected, actual)
+				t.Errorf("expected %v, got %v", td.expected, actual)
+			}
+		})
+	}
+}
+
+func TestTranspose(t *testing.T) {
+	g, err := Parse([]byte(`16x8
+#+++++++++++++++
+++++++++#+++++++
+++++++++++++++++
+++++++++++++++++
+++++++++++++++++
+++++++++++++++++
+++++++++++++++++
++++++++++++++++#
+`))
+	if err != nil {
+		t.Fatalf("cannot parse testdata: %v", err)
+	}
+	expected := &Grid{
+		width:  8,
+		height: 16,
+		b: []byte{
+			bits.Byte("10000000"),
+			bits.Byte("00000000"),
+			bits.Byte("00000000"),
+			bits.Byte("00000000"),
+			bits.Byte("00000000"),
+			bits.Byte("00000000"),
+			bits.Byte("00000000"),
+			bits.Byte("00000000"),
+			bits.Byte("01000000"),
+			bits.Byte("00000000"),
+			bits.Byte("00000000"),
+			bits.Byte("00000000"),
+			bits.Byte("00000000"),
+			bits.Byte("00000000"),
+			bits.Byte("00000000"),
+			bits.Byte("00000001"),
+		},
+	}
+	actual := g.Transpose()
+	if !actual.equalsTo(expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if back := actual.Transpose(); !back.equalsTo(g) {
+		t.Errorf("expected %v, got %v", g, back)
+	}
+
+	g, err = Parse([]byte("10x3\n#++++++++#\n++++++++++\n+#+#+#+#+#\n"))
+	if err != nil {
+		t.Fatalf("cannot parse testdata: %v", err)
+	}
+	want := "3x10\n#++\n++#\n+++\n++#\n+++\n++#\n+++\n++#\n+++\n#+#\n"
+	if got := string(g.Transpose().ToEfil()); got != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+	if back := g.Transpose().Transpose(); !back.equalsTo(g) {
+		t.Errorf("expected %v, got %v", g, back)
+	}
+}
+
+func TestStep(t *testing.T) {
+	for _, td := range []struct {
+		name string
+		// rule is Conway's if empty.
+		rule     string
+		input    string
+		expected string
+	}{
+		{
+			name: "torus",
+			input: `8x8
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+###+++++
+`,
+			expected: `8x8
++#++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
++#++++++
++#++++++
+`,
+		},
+		{
+			name: "plane",
+			input: `8x8 plane
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+###+++++
+`,
+			expected: `8x8 plane
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
++#++++++
++#++++++
+`,
+		},
+		{
+			name: "klein bottle",
+			input: `8x8 klein
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+###+++++
+`,
+			expected: `8x8 klein
+++++++#+
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
++#++++++
++#++++++
+`,
+		},
+		{
+			name: "projective plane",
+			input: `8x8 projective
+#+++++++
+#+++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+#+++++++
+`,
+			expected: `8x8 projective
+#+++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
++++++++#
+`,
+		},
+		{
+			name: "brian's brain",
+			rule: "/2/3",
+			input: `8x8 plane
+++++++++
+++++++++
+++##++++
+++AA++++
+++++++++
+++++++++
+++++++++
+++++++++
+`,
+			expected: `8x8 plane
+++++++++
+++##++++
+++AA++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+`,
+		},
+		{
+			name: "odd torus",
+			input: `5x5
++++++
++++++
++###+
++++++
++++++
+`,
+			expected: `5x5
++++++
+++#++
+++#++
+++#++
++++++
+`,
+		},
+		{
+			name: "narrow torus",
+			input: `3x1
+#++
+`,
+			// The dead cells see the living one thrice, in the column to
+			// their left or right, and it sees itself twice, above and below.
+			expected: `3x1
+###
+`,
+		},
+		{
+			name: "strobing background",
+			rule: "B0/S",
+			input: `8x8 plane
+++++++++
+++++++++
+++++++++
++++#++++
+++++++++
+++++++++
+++++++++
+++++++++
+`,
+			expected: `8x8 plane alive
+########
+########
+##+++###
+##+++###
+##+++###
+########
+########
+########
+`,
+		},
+		{
+			name: "alive background",
+			rule: "B0/S",
+			input: `8x8 plane alive
+########
+########
+##+++###
+##+++###
+##+++###
+########
+########
+########
+`,
+			expected: `8x8 plane
+++++++++
+++++++++
+++++++++
++++#++++
+++++++++
+++++++++
+++++++++
+++++++++
+`,
+		},
+		{
+			name: "hexagonal",
+			rule: "B2/S34H",
+			input: `8x8
+++++++++
+++++++++
+++++++++
+++##++++
+++++++++
+++++++++
+++++++++
+++++++++
+`,
+			expected: `8x8
+++++++++
+++++++++
+++#+++++
+++++++++
++++#++++
+++++++++
+++++++++
+++++++++
+`,
+		},
+		{
+			name: "star wars",
+			rule: "345/2/4",
+			input: `8x8
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++A+
+B+++++++
+`,
+			expected: `8x8
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++B+
+++++++++
+`,
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			g, err := Parse([]byte(td.input))
+			if err != nil {
+				t.Fatalf("cannot parse testdata: %v", err)
+			}
+			if td.rule != "" {
+				r, err := neighborhood.ParseRule(td.rule)
+				if err != nil {
+					t.Fatalf("cannot parse testdata: %v", err)
+				}
+				g.SetRule(r)
+			}
+			actual, err := g.Step()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(actual.ToEfil()) != td.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", td.expected, actual.ToEfil())
+			}
+		})
+	}
+}
+
+func TestRelative(t *testing.T) {
+	for _, td := range []struct {
+		name  string
+		rule  string
+		input string
+		// background is the one of the parents.
+		background state.State
+		failure    bool
+	}{
+		{name: "dead", rule: "B3/S23", input: "8x8 plane\n", background: state.Dead},
+		{name: "strobing dead", rule: "B013/S012", input: "8x8 plane\n", background: state.Alive},
+		{name: "strobing alive", rule: "B013/S012", input: "8x8 plane alive\n", background: state.Dead},
+		{name: "staying alive", rule: "B0/S8", input: "8x8 alive\n", background: state.Alive},
+		{name: "no birth", rule: "B3/S23", input: "8x8 plane alive\n", failure: true},
+		{name: "always born", rule: "B0/S8", input: "8x8 plane\n", failure: true},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			g, err := Parse([]byte(td.input + "++++++++\n+#++++++\n++#+++++\n###+++++\n++++++++\n++++++##\n++++++##\n++++++++\n"))
+			if err != nil {
+				t.Fatalf("cannot parse testdata: %v", err)
+			}
+			r, err := neighborhood.ParseRule(td.rule)
+			if err != nil {
+				t.Fatalf("cannot parse testdata: %v", err)
+			}
+			g.SetRule(r)
+			relative, err := g.Relative()
+			if td.failure {
+				if err == nil {
+					t.Errorf("expected a failure, got %v", relative)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := relative.Rule().ParentBackground(); got != td.background {
+				t.Errorf("expected the parents on %s, got %s", td.background.ToStr(), got.ToStr())
+			}
+			if relative.Background() != state.Dead {
+				t.Errorf("expected a dead background, got %s", relative.Background().ToStr())
+			}
+			if err := relative.CheckRelative(); err != nil {
+				t.Errorf("CheckRelative: unexpected error: %v", err)
+			}
+			if err := g.CheckRelative(); (err == nil) != (relative == g) {
+				t.Errorf("CheckRelative of the absolute grid: got %v", err)
+			}
+			if got := relative.Absolute(g.Background()); string(got.ToEfil()) != string(g.ToEfil()) || got.Rule() != r {
+				t.Errorf("expected:\n%s\ngot:\n%s", g.ToEfil(), got.ToEfil())
+			}
+			// The relative grid evolves the same as the absolute one.
+			parent := relative.Copy()
+			next, err := parent.Step()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			want, err := parent.Absolute(td.background).Step()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := next.Absolute(want.Background()); string(got.ToEfil()) != string(want.ToEfil()) {
+				t.Errorf("expected:\n%s\ngot:\n%s", want.ToEfil(), got.ToEfil())
 			}
 		})
 	}
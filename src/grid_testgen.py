@@ -14,7 +14,7 @@
 # See the License for the specific language governing permissions and
 # limitations under the License.
 
-"""Generates testcases for grid.torusGet"""
+"""Generates testcases for grid.topologyGet"""
 
 grid = [
     "++#+++++",
@@ -27,15 +27,45 @@ grid = [
     "+++++++#",
 ]
 
+# Mirrors the edges of grid.Topology implementations: (x edge, y edge).
+topologies = {
+    "Torus": ("wrap", "wrap"),
+    "Plane": ("dead", "dead"),
+    "Cylinder": ("wrap", "dead"),
+    "KleinBottle": ("wrap", "flip"),
+    "ProjectivePlane": ("flip", "flip"),
+}
+
+
+def resolve(topology, x, y):
+  """Returns the state at (x, y), or "Dead" if it is outside of the grid."""
+  xedge, yedge = topologies[topology]
+  while x < 0 or x >= 8:
+    if xedge == "dead":
+      return "Dead"
+    if xedge == "flip":
+      y = 7 - y
+    x = x + 8 if x < 0 else x - 8
+  while y < 0 or y >= 8:
+    if yedge == "dead":
+      return "Dead"
+    if yedge == "flip":
+      x = 7 - x
+    y = y + 8 if y < 0 else y - 8
+  return "Alive" if grid[y][x] == "#" else "Dead"
+
+
 cases = []
-for x in range(-1, 9):
-  for y in range(-1, 9):
-    cases.append(
+for topology in sorted(topologies):
+  for x in range(-2, 10):
+    for y in range(-2, 10):
+      cases.append(
 """		{{
+			topology: {},
 			x: {},
 			y: {},
 			expected: state.{},
-		}},""".format(x, y, "Alive" if grid[y % 8][x % 8] == "#" else "Dead"))
+		}},""".format(topology, x, y, resolve(topology, x, y)))
 
 print("""
 package grid
@@ -47,7 +77,7 @@ import (
 	"github.com/pawelz/efilfoemag/src/state"
 )
 
-func TestTorusGet(t *testing.T) {{
+func TestTopologyGet(t *testing.T) {{
 	testGrid, err := Parse([]byte(`8x8
 {}
 `))
@@ -55,14 +85,16 @@ func TestTorusGet(t *testing.T) {{
                 t.Fatalf("Cannot Parse test data: %v", err)
 	}}
 	for _, td := range []struct {{
+		topology Topology
 		x        int
 		y        int
 		expected state.State
 	}}{{
 {}
 	}}{{
-		t.Run(fmt.Sprintf("x=%d,y=%d", td.x, td.y), func(t *testing.T) {{
-			actual, err := testGrid.torusGet(td.x, td.y)
+		t.Run(fmt.Sprintf("%v,x=%d,y=%d", td.topology, td.x, td.y), func(t *testing.T) {{
+			testGrid.SetTopology(td.topology)
+			actual, err := testGrid.topologyGet(td.x, td.y)
 			if err != nil {{
 				t.Errorf("expected no error; got %v", err)
 			}}
@@ -0,0 +1,531 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hashlife
+
+import (
+	"fmt"
+
+	"github.com/pawelz/efilfoemag/src/grid"
+	"github.com/pawelz/efilfoemag/src/neighborhood"
+	"github.com/pawelz/efilfoemag/src/state"
+)
+
+// maxLevel is the level of the largest root, whose coordinates and size still fit in int64.
+const maxLevel = 62
+
+// DefaultMaxNodes is the number of the nodes, and of the memoised results, a new Universe keeps, see Universe.SetMaxNodes.
+const DefaultMaxNodes = 1 << 21
+
+// node is a square of 2^level x 2^level cells, made of the four quarters of the previous level.
+//
+// The nodes are canonical: there is a single node of any given content in a
+// Universe, see Universe.join, so that the nodes are compared, and their
+// results memoised, by the pointer. The nodes of level 0 are the single cells,
+// and have no quarters.
+type node struct {
+	nw, ne, sw, se *node
+	level          uint
+	population     uint64
+}
+
+// quad is the key of the nodes, their quarters.
+type quad [4]*node
+
+// resultKey is the key of the memoised results: the node and the logarithm of the number of generations.
+type resultKey struct {
+	n *node
+	k uint
+}
+
+// Universe is a pattern on the unbounded plane, evolved with the HashLife algorithm.
+//
+// The plane is a quadtree: the root node is centered at (0, 0), and grows as
+// needed. The result of a node, the center of it 2^k generations later, is
+// computed out of the results of its quarters, and memoised, so the repeated
+// parts of the pattern, in space and in time, are only evolved once. The
+// rules are the ones of the predecessor solver, see neighborhood.Rule, but
+// for the rules with dying states, and the ones giving birth to cells with no
+// living neighbours, which do not leave the plane dead around the pattern.
+type Universe struct {
+	rule       *neighborhood.Rule
+	root       *node
+	generation uint64
+	// leaves are the dead and the living cell.
+	leaves [2]*node
+	// empty holds the empty nodes, by the level.
+	empty   []*node
+	nodes   map[quad]*node
+	results map[resultKey]*node
+	// maxNodes is the limit of the nodes and the results kept between the
+	// steps, see collect.
+	maxNodes int
+}
+
+// New returns an empty Universe of the rule.
+func New(rule *neighborhood.Rule) (*Universe, error) {
+	if rule.States() > 2 {
+		return nil, fmt.Errorf("the %s rule has dying states, which are not supported", rule)
+	}
+	if rule.Next(0).IsAlive() {
+		return nil, fmt.Errorf("the %s rule gives birth to cells with no living neighbours, so the plane does not stay dead", rule)
+	}
+	u := &Universe{
+		rule:     rule,
+		nodes:    map[quad]*node{},
+		results:  map[resultKey]*node{},
+		maxNodes: DefaultMaxNodes,
+	}
+	u.leaves = [2]*node{{}, {population: 1}}
+	u.empty = []*node{u.leaves[0]}
+	u.root = u.emptyNode(3)
+	return u, nil
+}
+
+// FromGrid returns a Universe of the rule of the grid, with the living cells of the grid at the same coordinates.
+//
+// All the other cells of the plane are dead, whatever the topology of the
+// grid. The background of the grid must be dead, and the dying cells are
+// taken as dead.
+func FromGrid(g *grid.Grid) (*Universe, error) {
+	if g.Background().IsAlive() {
+		return nil, fmt.Errorf("the background of the grid must be dead")
+	}
+	u, err := New(g.Rule())
+	if err != nil {
+		return nil, err
+	}
+	level := uint(3)
+	for int64(1)<<(level-1) < int64(g.Width()) || int64(1)<<(level-1) < int64(g.Height()) {
+		level++
+	}
+	half := int64(1) << (level - 1)
+	u.root = u.fromGrid(g, level, -half, -half)
+	return u, nil
+}
+
+// fromGrid returns the node of the given level holding the cells of the grid from (x0, y0) on.
+func (u *Universe) fromGrid(g *grid.Grid, level uint, x0, y0 int64) *node {
+	size := int64(1) << level
+	if x0 >= int64(g.Width()) || y0 >= int64(g.Height()) || x0+size <= 0 || y0+size <= 0 {
+		return u.emptyNode(level)
+	}
+	if level == 0 {
+		s, _ := g.Get(uint(x0), uint(y0))
+		return u.leaf(s.IsAlive())
+	}
+	half := size / 2
+	return u.join(
+		u.fromGrid(g, level-1, x0, y0),
+		u.fromGrid(g, level-1, x0+half, y0),
+		u.fromGrid(g, level-1, x0, y0+half),
+		u.fromGrid(g, level-1, x0+half, y0+half),
+	)
+}
+
+// Rule returns the rule of the universe.
+func (u *Universe) Rule() *neighborhood.Rule {
+	return u.rule
+}
+
+// Generation returns the number of generations the universe has been evolved by.
+func (u *Universe) Generation() uint64 {
+	return u.generation
+}
+
+// Population returns the number of the living cells.
+func (u *Universe) Population() uint64 {
+	return u.root.population
+}
+
+// SetMaxNodes sets the number of the nodes, and of the memoised results, the universe keeps.
+//
+// When there are more of either before a step, the nodes which are neither in
+// the pattern nor empty are dropped, see collect. The limit is only checked
+// between the steps, so a single step may go beyond it, and the nodes of the
+// pattern are always kept, however many.
+func (u *Universe) SetMaxNodes(n int) {
+	u.maxNodes = n
+}
+
+// collect drops the nodes which are neither in the root nor empty, and the results of the nodes dropped.
+//
+// The nodes kept are the same pointers, so they stay canonical, and so do
+// their results, which are kept if they are nodes kept too.
+func (u *Universe) collect() {
+	nodes := map[quad]*node{}
+	var keep func(n *node)
+	keep = func(n *node) {
+		if n.level == 0 {
+			return
+		}
+		q := n.quad()
+		if _, ok := nodes[q]; ok {
+			return
+		}
+		nodes[q] = n
+		keep(n.nw)
+		keep(n.ne)
+		keep(n.sw)
+		keep(n.se)
+	}
+	keep(u.root)
+	for _, e := range u.empty {
+		keep(e)
+	}
+	kept := func(n *node) bool {
+		return n.level == 0 || nodes[n.quad()] == n
+	}
+	results := map[resultKey]*node{}
+	for key, rv := range u.results {
+		if kept(key.n) && kept(rv) {
+			results[key] = rv
+		}
+	}
+	u.nodes, u.results = nodes, results
+}
+
+// quad returns the quarters of the node, its key.
+func (n *node) quad() quad {
+	return quad{n.nw, n.ne, n.sw, n.se}
+}
+
+// leaf returns the cell of the given state.
+func (u *Universe) leaf(alive bool) *node {
+	if alive {
+		return u.leaves[1]
+	}
+	return u.leaves[0]
+}
+
+// join returns the node made of the given quarters, which must be of the same level.
+func (u *Universe) join(nw, ne, sw, se *node) *node {
+	q := quad{nw, ne, sw, se}
+	if n, ok := u.nodes[q]; ok {
+		return n
+	}
+	n := &node{
+		nw:         nw,
+		ne:         ne,
+		sw:         sw,
+		se:         se,
+		level:      nw.level + 1,
+		population: nw.population + ne.population + sw.population + se.population,
+	}
+	u.nodes[q] = n
+	return n
+}
+
+// emptyNode returns the node of the given level with no living cells.
+func (u *Universe) emptyNode(level uint) *node {
+	for uint(len(u.empty)) <= level {
+		e := u.empty[len(u.empty)-1]
+		u.empty = append(u.empty, u.join(e, e, e, e))
+	}
+	return u.empty[level]
+}
+
+// expand returns the node of the next level with n in its center, surrounded by dead cells.
+func (u *Universe) expand(n *node) *node {
+	e := u.emptyNode(n.level - 1)
+	return u.join(
+		u.join(e, e, e, n.nw),
+		u.join(e, e, n.ne, e),
+		u.join(e, n.sw, e, e),
+		u.join(n.se, e, e, e),
+	)
+}
+
+// centre returns the node of the previous level in the center of n.
+func (u *Universe) centre(n *node) *node {
+	return u.join(n.nw.se, n.ne.sw, n.sw.ne, n.se.nw)
+}
+
+// horizontal returns the node in between w and e, lying side by side.
+func (u *Universe) horizontal(w, e *node) *node {
+	return u.join(w.ne, e.nw, w.se, e.sw)
+}
+
+// vertical returns the node in between n and s, lying one above the other.
+func (u *Universe) vertical(n, s *node) *node {
+	return u.join(n.sw, n.se, s.nw, s.ne)
+}
+
+// result returns the center of the node, of the previous level, 2^k generations later.
+//
+// k must be at most the level of the node minus 2, so that nothing outside of
+// the node reaches the center in time. The node is split into nine
+// overlapping nodes of the previous level. With the largest k their results
+// are taken, which are half of the generations away, and combined into four
+// nodes, whose results are the other half. With a smaller k only their
+// centers are taken, so that all of the generations are left to the four.
+func (u *Universe) result(n *node, k uint) *node {
+	if n.population == 0 {
+		return u.emptyNode(n.level - 1)
+	}
+	key := resultKey{n, k}
+	if rv, ok := u.results[key]; ok {
+		return rv
+	}
+	var rv *node
+	if n.level == 2 {
+		rv = u.base(n)
+	} else {
+		half, rest := u.centre, k
+		if k == n.level-2 {
+			half = func(m *node) *node {
+				return u.result(m, k-1)
+			}
+			rest = k - 1
+		}
+		n00, n01, n02 := half(n.nw), half(u.horizontal(n.nw, n.ne)), half(n.ne)
+		n10, n11, n12 := half(u.vertical(n.nw, n.sw)), half(u.centre(n)), half(u.vertical(n.ne, n.se))
+		n20, n21, n22 := half(n.sw), half(u.horizontal(n.sw, n.se)), half(n.se)
+		rv = u.join(
+			u.result(u.join(n00, n01, n10, n11), rest),
+			u.result(u.join(n01, n02, n11, n12), rest),
+			u.result(u.join(n10, n11, n20, n21), rest),
+			u.result(u.join(n11, n12, n21, n22), rest),
+		)
+	}
+	u.results[key] = rv
+	return rv
+}
+
+// base returns the center of the node of level 2, 2x2 cells, in the next generation.
+func (u *Universe) base(n *node) *node {
+	var cells [4][4]state.State
+	for y := range cells {
+		for x := range cells[y] {
+			cells[y][x] = n.get(uint64(x), uint64(y))
+		}
+	}
+	var next [4]*node
+	for i := range next {
+		x, y := 1+i%2, 1+i/2
+		var nb neighborhood.Neighborhood
+		for _, side := range neighborhood.Sides() {
+			dx, dy := side.Offset()
+			nb.Set(side, cells[y+dy][x+dx])
+		}
+		next[i] = u.leaf(u.rule.Next(nb).IsAlive())
+	}
+	return u.join(next[0], next[1], next[2], next[3])
+}
+
+// get returns the state of the cell of the node at the address, counted from its top-left corner.
+func (n *node) get(x, y uint64) state.State {
+	for n.level > 0 {
+		half := uint64(1) << (n.level - 1)
+		switch {
+		case x < half && y < half:
+			n = n.nw
+		case y < half:
+			n, x = n.ne, x-half
+		case x < half:
+			n, y = n.sw, y-half
+		default:
+			n, x, y = n.se, x-half, y-half
+		}
+	}
+	return state.Of(n.population != 0)
+}
+
+// set returns the node with the cell at the address, counted from its top-left corner, set to the state.
+func (u *Universe) set(n *node, x, y uint64, alive bool) *node {
+	if n.level == 0 {
+		return u.leaf(alive)
+	}
+	half := uint64(1) << (n.level - 1)
+	nw, ne, sw, se := n.nw, n.ne, n.sw, n.se
+	switch {
+	case x < half && y < half:
+		nw = u.set(nw, x, y, alive)
+	case y < half:
+		ne = u.set(ne, x-half, y, alive)
+	case x < half:
+		sw = u.set(sw, x, y-half, alive)
+	default:
+		se = u.set(se, x-half, y-half, alive)
+	}
+	return u.join(nw, ne, sw, se)
+}
+
+// contains returns true iff the cell at the address lies within the root.
+func (u *Universe) contains(x, y int64) bool {
+	half := int64(1) << (u.root.level - 1)
+	return x >= -half && x < half && y >= -half && y < half
+}
+
+// Get returns the state of the cell at the given address.
+func (u *Universe) Get(x, y int64) state.State {
+	if !u.contains(x, y) {
+		return state.Dead
+	}
+	half := int64(1) << (u.root.level - 1)
+	return u.root.get(uint64(x+half), uint64(y+half))
+}
+
+// Set sets the state of the cell at the given address, which must be dead or alive.
+func (u *Universe) Set(x, y int64, s state.State) error {
+	if s.IsDying() {
+		return fmt.Errorf("cannot Set: dying states are not supported")
+	}
+	for !u.contains(x, y) {
+		if u.root.level == maxLevel {
+			return fmt.Errorf("cannot Set: address (%d, %d) is too far from the origin", x, y)
+		}
+		u.root = u.expand(u.root)
+	}
+	half := int64(1) << (u.root.level - 1)
+	u.root = u.set(u.root, uint64(x+half), uint64(y+half), s.IsAlive())
+	return nil
+}
+
+// StepPow2 evolves the universe by 2^k generations at once.
+//
+// The root is first expanded until the pattern is within its center quarter,
+// and k is at most its level minus 3, so that the result of the root holds
+// all of the pattern 2^k generations later. The nodes beyond the limit of
+// SetMaxNodes are dropped first.
+func (u *Universe) StepPow2(k uint) error {
+	if len(u.nodes) > u.maxNodes || len(u.results) > u.maxNodes {
+		u.collect()
+	}
+	for u.root.level < k+3 || u.centre(u.centre(u.root)).population != u.root.population {
+		if u.root.level == maxLevel {
+			return fmt.Errorf("cannot Step: the pattern outgrows the plane of %d x %d cells", int64(1)<<(maxLevel-1), int64(1)<<(maxLevel-1))
+		}
+		u.root = u.expand(u.root)
+	}
+	u.root = u.expand(u.result(u.root, k))
+	u.generation += 1 << k
+	return nil
+}
+
+// StepN evolves the universe by n generations, a power of 2 at a time, see StepPow2.
+func (u *Universe) StepN(n uint64) error {
+	for k := uint(0); n>>k != 0; k++ {
+		if n&(1<<k) == 0 {
+			continue
+		}
+		if err := u.StepPow2(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// box is a rectangle of cells, from (x0, y0) to (x1, y1), all included.
+type box struct {
+	x0, y0, x1, y1 int64
+	ok             bool
+}
+
+// add extends the box to the living cells of the node with the top-left corner at (x, y).
+//
+// The nodes already within the box are skipped.
+func (b *box) add(n *node, x, y int64) {
+	if n.population == 0 {
+		return
+	}
+	size := int64(1) << n.level
+	if b.ok && x >= b.x0 && y >= b.y0 && x+size-1 <= b.x1 && y+size-1 <= b.y1 {
+		return
+	}
+	if n.level == 0 {
+		if !b.ok {
+			*b = box{x0: x, y0: y, x1: x, y1: y, ok: true}
+		}
+		if x < b.x0 {
+			b.x0 = x
+		}
+		if y < b.y0 {
+			b.y0 = y
+		}
+		if x > b.x1 {
+			b.x1 = x
+		}
+		if y > b.y1 {
+			b.y1 = y
+		}
+		return
+	}
+	half := size / 2
+	b.add(n.nw, x, y)
+	b.add(n.ne, x+half, y)
+	b.add(n.sw, x, y+half)
+	b.add(n.se, x+half, y+half)
+}
+
+// Bounds returns the smallest rectangle holding all the living cells, as the address of its top-left corner and its size.
+//
+// It returns false if there are no living cells.
+func (u *Universe) Bounds() (x, y int64, width, height uint64, ok bool) {
+	var b box
+	half := int64(1) << (u.root.level - 1)
+	b.add(u.root, -half, -half)
+	if !b.ok {
+		return 0, 0, 0, 0, false
+	}
+	return b.x0, b.y0, uint64(b.x1 - b.x0 + 1), uint64(b.y1 - b.y0 + 1), true
+}
+
+// Window returns the cells of the rectangle with the top-left corner at (x, y) and the given size, as a grid.
+//
+// The grid is a grid.Plane of the rule of the universe.
+func (u *Universe) Window(x, y int64, width, height uint) (*grid.Grid, error) {
+	g, err := grid.New(int(width), int(height))
+	if err != nil {
+		return nil, err
+	}
+	g.SetTopology(grid.Plane)
+	g.SetRule(u.rule)
+	half := int64(1) << (u.root.level - 1)
+	fill(u.root, -half, -half, g, x, y)
+	return g, nil
+}
+
+// fill sets the living cells of the node with the top-left corner at (x0, y0) in the grid with the top-left corner at (x, y).
+func fill(n *node, x0, y0 int64, g *grid.Grid, x, y int64) {
+	size := int64(1) << n.level
+	if n.population == 0 || x0 >= x+int64(g.Width()) || y0 >= y+int64(g.Height()) || x0+size <= x || y0+size <= y {
+		return
+	}
+	if n.level == 0 {
+		g.Set(uint(x0-x), uint(y0-y), state.Alive)
+		return
+	}
+	half := size / 2
+	fill(n.nw, x0, y0, g, x, y)
+	fill(n.ne, x0+half, y0, g, x, y)
+	fill(n.sw, x0, y0+half, g, x, y)
+	fill(n.se, x0+half, y0+half, g, x, y)
+}
+
+// ToGrid returns the living cells as a grid, see Window, together with the address of its top-left corner.
+//
+// The grid is the smallest one holding all the living cells, see Bounds, or a
+// single dead cell at (0, 0) if there are none.
+func (u *Universe) ToGrid() (*grid.Grid, int64, int64, error) {
+	x, y, width, height, ok := u.Bounds()
+	if !ok {
+		width, height = 1, 1
+	}
+	if width > 1<<30 || height > 1<<30 || width*height > 1<<32 {
+		return nil, 0, 0, fmt.Errorf("the pattern of %dx%d cells is too large for a grid", width, height)
+	}
+	g, err := u.Window(x, y, uint(width), uint(height))
+	return g, x, y, err
+}
@@ -0,0 +1,231 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hashlife
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/pawelz/efilfoemag/src/grid"
+	"github.com/pawelz/efilfoemag/src/neighborhood"
+	"github.com/pawelz/efilfoemag/src/state"
+)
+
+const glider = `3x3 plane
++#+
+++#
+###
+`
+
+func parseGrid(input string, t *testing.T) *grid.Grid {
+	t.Helper()
+	g, err := grid.Parse([]byte(input))
+	if err != nil {
+		t.Fatalf("cannot parse testdata: %v", err)
+	}
+	return g
+}
+
+func TestNew(t *testing.T) {
+	for _, td := range []struct {
+		rule string
+		ok   bool
+	}{
+		{rule: "B3/S23", ok: true},
+		{rule: "B2/S34H", ok: true},
+		{rule: "B2-a/S12", ok: true},
+		{rule: "B0/S8"},
+		{rule: "B2/S/C3"},
+	} {
+		t.Run(td.rule, func(t *testing.T) {
+			r, err := neighborhood.ParseRule(td.rule)
+			if err != nil {
+				t.Fatalf("cannot parse testdata: %v", err)
+			}
+			if _, err := New(r); (err == nil) != td.ok {
+				t.Errorf("expected success: %v, got %v", td.ok, err)
+			}
+		})
+	}
+}
+
+func TestStepN(t *testing.T) {
+	const size, steps = 12, 37
+	r := rand.New(rand.NewSource(1))
+	for _, rule := range []string{"B3/S23", "B36/S23", "B2/S34H", "B2/S013V", "B2-a/S12"} {
+		for _, n := range []uint64{0, 1, 2, 7, steps} {
+			t.Run(fmt.Sprintf("%s/%d", rule, n), func(t *testing.T) {
+				// The cells cannot get further than a cell away in a
+				// generation, so the plane grid has room for all of them.
+				margin := uint(steps + 1)
+				g, err := grid.New(size+2*int(margin), size+2*int(margin))
+				if err != nil {
+					t.Fatal(err)
+				}
+				g.SetTopology(grid.Plane)
+				if g.SetRule(neighborhood.Conway); rule != "B3/S23" {
+					rr, err := neighborhood.ParseRule(rule)
+					if err != nil {
+						t.Fatalf("cannot parse testdata: %v", err)
+					}
+					g.SetRule(rr)
+				}
+				for y := margin; y < margin+size; y++ {
+					for x := margin; x < margin+size; x++ {
+						g.Set(x, y, state.Of(r.Intn(2) == 0))
+					}
+				}
+				u, err := FromGrid(g)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if err := u.StepN(n); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				want, err := g.StepN(uint(n))
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := u.Window(0, 0, g.Width(), g.Height())
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !got.EqualsTo(want) {
+					t.Errorf("expected:\n%s\ngot:\n%s", want.ToEfil(), got.ToEfil())
+				}
+				if got, want := u.Generation(), n; got != want {
+					t.Errorf("Generation: expected %d, got %d", want, got)
+				}
+			})
+		}
+	}
+}
+
+func TestLongRun(t *testing.T) {
+	u, err := FromGrid(parseGrid(glider, t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The glider moves by a cell diagonally every 4 generations.
+	if err := u.StepPow2(40); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	g, x, y, err := u.ToGrid()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := int64(1) << 38; x != want || y != want {
+		t.Errorf("expected the glider at (%d, %d), got (%d, %d)", want, want, x, y)
+	}
+	if string(g.ToEfil()) != glider {
+		t.Errorf("expected:\n%s\ngot:\n%s", glider, g.ToEfil())
+	}
+	if got := u.Population(); got != 5 {
+		t.Errorf("Population: expected 5, got %d", got)
+	}
+}
+
+func TestMaxNodes(t *testing.T) {
+	const size = 24
+	r := rand.New(rand.NewSource(1))
+	g, err := grid.New(size, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.SetTopology(grid.Plane)
+	g.SetRule(neighborhood.Conway)
+	for y := uint(0); y < size; y++ {
+		for x := uint(0); x < size; x++ {
+			g.Set(x, y, state.Of(r.Intn(2) == 0))
+		}
+	}
+	want, err := FromGrid(g)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := FromGrid(g)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got.SetMaxNodes(500)
+	for n := uint64(1); n <= 40; n++ {
+		if err := want.StepN(n); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := got.StepN(n); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		wg, wx, wy, err := want.ToGrid()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		gg, gx, gy, err := got.ToGrid()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if gx != wx || gy != wy || !gg.EqualsTo(wg) {
+			t.Fatalf("generation %d: expected at (%d, %d):\n%s\ngot at (%d, %d):\n%s", want.Generation(), wx, wy, wg.ToEfil(), gx, gy, gg.ToEfil())
+		}
+	}
+	got.collect()
+	if len(got.nodes) >= len(want.nodes) {
+		t.Errorf("expected fewer than %d nodes, got %d", len(want.nodes), len(got.nodes))
+	}
+	root := got.root
+	if n := got.join(root.nw, root.ne, root.sw, root.se); n != root {
+		t.Errorf("expected the root to stay canonical")
+	}
+}
+
+func TestSetGet(t *testing.T) {
+	u, err := New(neighborhood.Conway)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, _, ok := u.Bounds(); ok {
+		t.Errorf("Bounds: expected no living cells")
+	}
+	cells := [][2]int64{{-5, 3}, {1000, -20}, {-1 << 40, 1 << 40}}
+	for _, c := range cells {
+		if err := u.Set(c[0], c[1], state.Alive); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	for _, c := range cells {
+		if s := u.Get(c[0], c[1]); !s.IsAlive() {
+			t.Errorf("Get(%d, %d): expected alive, got %s", c[0], c[1], s.ToStr())
+		}
+	}
+	if s := u.Get(1<<61, 0); s.IsAlive() {
+		t.Errorf("Get(2^61, 0): expected dead, got %s", s.ToStr())
+	}
+	x, y, w, h, ok := u.Bounds()
+	if !ok || x != -1<<40 || y != -20 || w != 1<<40+1001 || h != 1<<40+21 {
+		t.Errorf("Bounds: got (%d, %d) %dx%d, %v", x, y, w, h, ok)
+	}
+	if _, _, _, err := u.ToGrid(); err == nil {
+		t.Errorf("ToGrid: expected an error for a pattern %dx%d", w, h)
+	}
+	if err := u.Set(-5, 3, state.Dead); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := u.Population(); got != 2 {
+		t.Errorf("Population: expected 2, got %d", got)
+	}
+	if err := u.Set(1<<62, 0, state.Alive); err == nil {
+		t.Errorf("Set(2^62, 0): expected an error")
+	}
+}
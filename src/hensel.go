@@ -0,0 +1,192 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package neighborhood
+
+import (
+	"fmt"
+	"strings"
+)
+
+// henselLetters lists the letters of the Hensel notation for every number of living neighbours, in the canonical order.
+//
+// A letter names a class of arrangements of the living neighbours, equal up
+// to rotations and reflections. The arrangements of 5 to 7 neighbours are
+// named after the ones of 3 to 1 dead neighbours.
+var henselLetters = [9]string{"", "ce", "ceaikn", "ceaiknjqry", "ceaiknjqrytwz", "ceaiknjqry", "ceaikn", "ce", ""}
+
+// henselClasses holds a representative arrangement of every letter of up to 4 neighbours.
+var henselClasses = []struct {
+	count  int
+	letter byte
+	n      string
+}{
+	{count: 1, letter: 'c', n: "#++,+++,+++"},
+	{count: 1, letter: 'e', n: "+#+,+++,+++"},
+	{count: 2, letter: 'c', n: "#+#,+++,+++"},
+	{count: 2, letter: 'e', n: "+#+,#++,+++"},
+	{count: 2, letter: 'a', n: "##+,+++,+++"},
+	{count: 2, letter: 'i', n: "+++,#+#,+++"},
+	{count: 2, letter: 'k', n: "#++,++#,+++"},
+	{count: 2, letter: 'n', n: "++#,+++,#++"},
+	{count: 3, letter: 'c', n: "#+#,+++,#++"},
+	{count: 3, letter: 'e', n: "+#+,#+#,+++"},
+	{count: 3, letter: 'a', n: "##+,#++,+++"},
+	{count: 3, letter: 'i', n: "###,+++,+++"},
+	{count: 3, letter: 'k', n: "+#+,++#,#++"},
+	{count: 3, letter: 'n', n: "#+#,#++,+++"},
+	{count: 3, letter: 'j', n: "+##,#++,+++"},
+	{count: 3, letter: 'q', n: "+##,+++,#++"},
+	{count: 3, letter: 'r', n: "#++,#+#,+++"},
+	{count: 3, letter: 'y', n: "#++,++#,#++"},
+	{count: 4, letter: 'c', n: "#+#,+++,#+#"},
+	{count: 4, letter: 'e', n: "+#+,#+#,+#+"},
+	{count: 4, letter: 'a', n: "###,#++,+++"},
+	{count: 4, letter: 'i', n: "#+#,#+#,+++"},
+	{count: 4, letter: 'k', n: "##+,++#,#++"},
+	{count: 4, letter: 'n', n: "###,+++,#++"},
+	{count: 4, letter: 'j', n: "+#+,#+#,#++"},
+	{count: 4, letter: 'q', n: "+##,++#,#++"},
+	{count: 4, letter: 'r', n: "##+,#+#,+++"},
+	{count: 4, letter: 'y', n: "#+#,++#,#++"},
+	{count: 4, letter: 't', n: "#++,#+#,#++"},
+	{count: 4, letter: 'w', n: "+##,#++,#++"},
+	{count: 4, letter: 'z', n: "++#,#+#,#++"},
+}
+
+// henselLetter is the letter of every neighborhood, regardless of its center. It is 0 for 0 and 8 neighbours.
+var henselLetter = newHenselLetter()
+
+// mirror returns the neighborhood mirrored along the N-S axis.
+func (n Neighborhood) mirror() Neighborhood {
+	var rv Neighborhood
+	for _, s := range sides {
+		ox, oy := s.Offset()
+		if n&(1<<uint(s)) != 0 {
+			rv |= 1 << uint(4+ox-3*oy)
+		}
+	}
+	return rv
+}
+
+// neighbours returns the number of living neighbours, i.e. cells other than C.
+func (n Neighborhood) neighbours() int {
+	var rv int
+	for _, s := range sides {
+		if s != C && n&(1<<uint(s)) != 0 {
+			rv++
+		}
+	}
+	return rv
+}
+
+func newHenselLetter() *[0x200]byte {
+	var rv [0x200]byte
+	// Every class is the orbit of its representative under the reflections,
+	// which generate all the rotations too.
+	for _, class := range henselClasses {
+		n, err := Parse(class.n)
+		if err != nil {
+			panic(err)
+		}
+		queue := []Neighborhood{n}
+		if class.count < 4 {
+			// The complement of a class of 4 neighbours is another class.
+			queue = append(queue, n^0x1ef)
+		}
+		for len(queue) > 0 {
+			m := queue[0]
+			queue = queue[1:]
+			letter := rv[m]
+			if letter == class.letter {
+				continue
+			}
+			if letter != 0 {
+				panic(fmt.Sprintf("%s is both %d%c and %d%c", m.ToStr(), m.neighbours(), letter, m.neighbours(), class.letter))
+			}
+			rv[m] = class.letter
+			rv[m|1<<uint(C)] = class.letter
+			queue = append(queue, m.Transpose(), m.mirror())
+		}
+	}
+	return &rv
+}
+
+// HenselLetter returns the number of living neighbours and the letter of the Hensel notation of the neighborhood.
+//
+// The letter is 0 for 0 and 8 neighbours, which have no letters.
+func HenselLetter(n Neighborhood) (int, byte) {
+	return n.neighbours(), henselLetter[n&0x1ff]
+}
+
+// parseHensel parses a part of a rule in the Hensel notation, e.g. "2-a3", without its B or S.
+//
+// It returns for every number of neighbours the set of the letters included,
+// and the canonical form of the part.
+func parseHensel(part string) (*[9]map[byte]bool, string, error) {
+	var rv [9]map[byte]bool
+	var canonical [9]string
+	for len(part) > 0 {
+		d := part[0]
+		if d < '0' || d > '8' {
+			return nil, "", fmt.Errorf("%q is not a number of neighbours", d)
+		}
+		count := int(d - '0')
+		if rv[count] != nil {
+			return nil, "", fmt.Errorf("%q is repeated", d)
+		}
+		part = part[1:]
+		negative := strings.HasPrefix(part, "-")
+		if negative {
+			part = part[1:]
+		}
+		end := strings.IndexAny(part, "012345678")
+		if end == -1 {
+			end = len(part)
+		}
+		letters := part[:end]
+		part = part[end:]
+		if negative && letters == "" {
+			return nil, "", fmt.Errorf("missing letters after %c-", d)
+		}
+		given := map[byte]bool{}
+		for i := 0; i < len(letters); i++ {
+			if strings.IndexByte(henselLetters[count], letters[i]) == -1 {
+				return nil, "", fmt.Errorf("%q is not a letter of %d neighbours, want one of %q", letters[i], count, henselLetters[count])
+			}
+			if given[letters[i]] {
+				return nil, "", fmt.Errorf("%c%c is repeated", d, letters[i])
+			}
+			given[letters[i]] = true
+		}
+		rv[count] = map[byte]bool{}
+		canonical[count] = string(d)
+		if negative {
+			canonical[count] += "-"
+		}
+		for i := 0; i < len(henselLetters[count]); i++ {
+			l := henselLetters[count][i]
+			if given[l] {
+				canonical[count] += string(l)
+			}
+			if letters == "" || given[l] != negative {
+				rv[count][l] = true
+			}
+		}
+		if count == 0 || count == 8 {
+			rv[count][0] = true
+		}
+	}
+	return &rv, strings.Join(canonical[:], ""), nil
+}
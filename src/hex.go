@@ -0,0 +1,53 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package neighborhood
+
+// HexSides returns all sides of the hexagonal neighborhood, including C, in the reading order.
+//
+// The hexagonal neighborhood is emulated on the square grid, as in Golly: the
+// rows of the hexagons are skewed, so that the six neighbours of a cell are
+// the Moore neighbours but NE and SW. It goes like that:
+//
+//    NW  N
+//
+//    W   C   E
+//
+//        S   SE
+func HexSides() []Side {
+	return Hex.Sides()
+}
+
+// IsHex returns true iff the neighborhood is hexagonal, i.e. its NE and SW cells are dead.
+//
+// The hexagonal neighborhoods ignore these cells, so they are always kept dead.
+func (n Neighborhood) IsHex() bool {
+	return Hex.Contains(n)
+}
+
+// MatchesHex checks whether the other hexagonal neighborhood matches the current at given distance and side.
+//
+// This is Matches restricted to the cells of the hexagonal neighborhoods, so
+// for example the neighborhoods at distance 2 and side NE share no cells, and
+// always match.
+func (n Neighborhood) MatchesHex(k Neighborhood, dist int, s Side) (bool, error) {
+	return Hex.Matches(n, k, dist, s)
+}
+
+// ShiftIntersectHex performs the "shift & intersect" operation on sets of hexagonal neighborhoods.
+//
+// This is ShiftIntersectAt with the matching of MatchesHex.
+func ShiftIntersectHex(left *Set, right *Set, dist int, s Side) (*Set, *Set, error) {
+	return Hex.ShiftIntersect(left, right, dist, s)
+}
@@ -0,0 +1,130 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package neighborhood
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMatchesHex(t *testing.T) {
+	all := []Side{NW, N, NE, W, E, SW, S, SE}
+	for _, td := range []struct {
+		n            string
+		k            string
+		matchesDist1 []Side
+		matchesDist2 []Side
+	}{
+		{
+			// The NE and SW cells are dead, but they are not compared.
+			n:            "##+,###,+##",
+			k:            "##+,###,+##",
+			matchesDist1: all,
+			matchesDist2: all,
+		},
+		{
+			// At distance 2 NE and SW no hexagonal cells are shared.
+			n:            "+++,+++,+++",
+			k:            "##+,###,+##",
+			matchesDist2: []Side{NE, SW},
+		},
+		{
+			n:            "+#+,##+,+++",
+			k:            "+++,+#+,+#+",
+			matchesDist1: []Side{N},
+			matchesDist2: []Side{NW, N, NE, E, SW, S, SE},
+		},
+	} {
+		for _, dist := range []int{1, 2} {
+			want := map[Side]bool{}
+			for _, side := range map[int][]Side{1: td.matchesDist1, 2: td.matchesDist2}[dist] {
+				want[side] = true
+			}
+			for _, side := range all {
+				t.Run(fmt.Sprintf("%s/%s/dist=%d,side=%s", td.n, td.k, dist, side.ToStr()), func(t *testing.T) {
+					n, err := Parse(td.n)
+					if err != nil {
+						t.Fatalf("unable to parse testdata n: %v", err)
+					}
+					k, err := Parse(td.k)
+					if err != nil {
+						t.Fatalf("unable to parse testdata k: %v", err)
+					}
+					got, err := n.MatchesHex(k, dist, side)
+					if err != nil {
+						t.Fatalf("unexpected error: %v", err)
+					}
+					if got != want[side] {
+						t.Errorf("want %v got %v", want[side], got)
+					}
+				})
+			}
+		}
+	}
+	if _, err := Neighborhood(0).MatchesHex(0, 1, C); err == nil {
+		t.Errorf("expected a failure for C")
+	}
+}
+
+func TestShiftIntersectHex(t *testing.T) {
+	// ShiftIntersectHex must agree with the pairwise MatchesHex, and keep at
+	// least the pairs of hexagonal neighborhoods that Matches.
+	var hex []Neighborhood
+	for n := Neighborhood(0); n < 0x200; n += 7 {
+		if n.IsHex() {
+			hex = append(hex, n)
+		}
+	}
+	left, right := &Set{}, &Set{}
+	for i, n := range hex {
+		if i%2 == 0 {
+			left.Add(n)
+		} else {
+			right.Add(n)
+		}
+	}
+	for _, dist := range []int{1, 2} {
+		for _, side := range []Side{NW, N, NE, W, E, SW, S, SE} {
+			t.Run(fmt.Sprintf("dist=%d,side=%s", dist, side.ToStr()), func(t *testing.T) {
+				wantL, wantR := &Set{}, &Set{}
+				for _, n := range left.Elements() {
+					for _, k := range right.Elements() {
+						match, err := n.MatchesHex(k, dist, side)
+						if err != nil {
+							t.Fatal(err)
+						}
+						if moore, _ := n.Matches(k, dist, side); moore && !match {
+							t.Errorf("%s and %s match, but not as hexagonal neighborhoods", n.ToStr(), k.ToStr())
+						}
+						if match {
+							wantL.Add(n)
+							wantR.Add(k)
+						}
+					}
+				}
+				gotL, gotR, err := ShiftIntersectHex(left, right, dist, side)
+				if err != nil {
+					t.Fatalf("ShiftIntersectHex returned error: %v", err)
+				}
+				if !Equals(wantL, gotL) {
+					t.Errorf("the left set is invalid: want %v, got %v", wantL, gotL)
+				}
+				if !Equals(wantR, gotR) {
+					t.Errorf("the right set is invalid: want %v, got %v", wantR, gotR)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,334 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ltl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pawelz/efilfoemag/src/cnf"
+	"github.com/pawelz/efilfoemag/src/grid"
+	"github.com/pawelz/efilfoemag/src/sat"
+	"github.com/pawelz/efilfoemag/src/state"
+)
+
+// Rule is a Larger than Life rule: a totalistic rule counting the living cells within a range around every cell.
+//
+// The window of a cell is the square of the cells up to Range away from it,
+// or with VonNeumann the diamond of the cells up to Range away in the sum of
+// both directions. A dead cell is born iff the number of the living cells in
+// its window is within Birth, and a living one survives iff it is within
+// Survival. The cell itself is counted iff Middle.
+type Rule struct {
+	Range      int
+	Middle     bool
+	VonNeumann bool
+	// Survival and Birth are the ranges of the counts, both ends included.
+	Survival [2]int
+	Birth    [2]int
+}
+
+// IsRule returns true iff the rulestring is a Larger than Life one, i.e. its parts are separated by commas.
+func IsRule(s string) bool {
+	return strings.Contains(s, ",")
+}
+
+// ParseRule parses a Larger than Life rule in the notation of Golly, e.g. "R5,C0,M1,S34..58,B34..45,NM".
+//
+// R is the range, M1 counts the cell itself, S and B are the ranges of the
+// counts letting a living cell survive and giving birth to a dead one, and NM
+// and NN are the square (Moore) and the diamond (von Neumann) windows. The
+// parts may come in any order, and C, M and N may be left out: they are C0, M0
+// and NM by default. Only the rules of two states, C0 or C2, are supported.
+func ParseRule(s string) (*Rule, error) {
+	r := &Rule{}
+	seen := map[byte]bool{}
+	for _, part := range strings.Split(strings.ToUpper(s), ",") {
+		if part == "" || seen[part[0]] {
+			return nil, fmt.Errorf("invalid rule %q: empty or repeated part %q", s, part)
+		}
+		seen[part[0]] = true
+		var err error
+		switch value := part[1:]; part[0] {
+		case 'R':
+			if r.Range, err = strconv.Atoi(value); err == nil && r.Range < 1 {
+				err = fmt.Errorf("the range must be positive, got %d", r.Range)
+			}
+		case 'C':
+			var states int
+			if states, err = strconv.Atoi(value); err == nil && states != 0 && states != 2 {
+				err = fmt.Errorf("only the rules of two states are supported, got %d states", states)
+			}
+		case 'M':
+			if value != "0" && value != "1" {
+				err = fmt.Errorf("want M0 or M1, got %q", part)
+			}
+			r.Middle = value == "1"
+		case 'S':
+			r.Survival, err = parseRange(value)
+		case 'B':
+			r.Birth, err = parseRange(value)
+		case 'N':
+			if value != "M" && value != "N" {
+				err = fmt.Errorf("want NM or NN, got %q", part)
+			}
+			r.VonNeumann = value == "N"
+		default:
+			err = fmt.Errorf("unknown part %q", part)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule %q: %v", s, err)
+		}
+	}
+	for _, p := range "RSB" {
+		if !seen[byte(p)] {
+			return nil, fmt.Errorf("invalid rule %q: missing %c", s, p)
+		}
+	}
+	for _, b := range [][2]int{r.Survival, r.Birth} {
+		if b[1] > r.Size() {
+			return nil, fmt.Errorf("invalid rule %q: the counts must be at most %d, got %d", s, r.Size(), b[1])
+		}
+	}
+	return r, nil
+}
+
+// parseRange parses a range of counts, e.g. "34..58", or a single count.
+func parseRange(s string) ([2]int, error) {
+	ends := strings.SplitN(s, "..", 2)
+	if len(ends) == 1 {
+		ends = append(ends, ends[0])
+	}
+	var rv [2]int
+	for i, e := range ends {
+		v, err := strconv.Atoi(e)
+		if err != nil || v < 0 {
+			return rv, fmt.Errorf("invalid range %q", s)
+		}
+		rv[i] = v
+	}
+	if rv[0] > rv[1] {
+		return rv, fmt.Errorf("invalid range %q: the ends are reversed", s)
+	}
+	return rv, nil
+}
+
+// String returns the rule in the canonical notation.
+func (r *Rule) String() string {
+	m, n := 0, "M"
+	if r.Middle {
+		m = 1
+	}
+	if r.VonNeumann {
+		n = "N"
+	}
+	return fmt.Sprintf("R%d,C0,M%d,S%d..%d,B%d..%d,N%s", r.Range, m, r.Survival[0], r.Survival[1], r.Birth[0], r.Birth[1], n)
+}
+
+// height returns the number of cells above the center of the column of the window at the horizontal offset dx.
+func (r *Rule) height(dx int) int {
+	if dx < 0 {
+		dx = -dx
+	}
+	if r.VonNeumann {
+		return r.Range - dx
+	}
+	return r.Range
+}
+
+// Size returns the number of the cells counted in a window.
+func (r *Rule) Size() int {
+	var rv int
+	for dx := -r.Range; dx <= r.Range; dx++ {
+		rv += 2*r.height(dx) + 1
+	}
+	if !r.Middle {
+		rv--
+	}
+	return rv
+}
+
+// next returns true iff a cell of the given state, with count living cells in the window, evolves into a living cell.
+func (r *Rule) next(alive bool, count int) bool {
+	b := r.Birth
+	if alive {
+		b = r.Survival
+	}
+	return b[0] <= count && count <= b[1]
+}
+
+// Step returns the next generation of the grid, following the rule.
+//
+// The cells of the windows beyond the edges are resolved with the topology of
+// the grid. The rule of the grid itself is ignored.
+func (r *Rule) Step(g *grid.Grid) (*grid.Grid, error) {
+	w, h := g.Width(), g.Height()
+	next := g.Blank()
+	for y := 0; y < int(h); y++ {
+		for x := 0; x < int(w); x++ {
+			var count int
+			for dx := -r.Range; dx <= r.Range; dx++ {
+				for dy := -r.height(dx); dy <= r.height(dx); dy++ {
+					if dx == 0 && dy == 0 && !r.Middle {
+						continue
+					}
+					nx, ny, ok := g.Topology().Resolve(x+dx, y+dy, w, h)
+					if !ok {
+						continue
+					}
+					s, err := g.Get(nx, ny)
+					if err != nil {
+						return nil, fmt.Errorf("cannot Step: %v", err)
+					}
+					if s.IsAlive() {
+						count++
+					}
+				}
+			}
+			s, err := g.Get(uint(x), uint(y))
+			if err != nil {
+				return nil, fmt.Errorf("cannot Step: %v", err)
+			}
+			if r.next(s.IsAlive(), count) {
+				if err := next.Set(uint(x), uint(y), state.Alive); err != nil {
+					return nil, fmt.Errorf("cannot Step: %v", err)
+				}
+			}
+		}
+	}
+	return next, nil
+}
+
+// Encode returns a formula whose models are exactly the parents of the target under the rule.
+//
+// There is one variable per parent cell, see cnf.Var, and the auxiliary
+// variables follow them. The windows are far too many to list, so the count
+// of every window is encoded with binary adders instead, see cnf.Formula.Sum,
+// and bounded with a clause for every count it must not have. The columns of
+// the windows are summed once, and shared by all the windows they are in.
+func Encode(target *grid.Grid, r *Rule) (*cnf.Formula, error) {
+	w, h := target.Width(), target.Height()
+	f := &cnf.Formula{NumVars: int(w * h)}
+	// cell returns the variable of the parent cell, or 0 outside of the grid.
+	cell := func(x, y int) int {
+		nx, ny, ok := target.Topology().Resolve(x, y, w, h)
+		if !ok {
+			return 0
+		}
+		return cnf.Var(w, nx, ny)
+	}
+	// columns caches the sums of the columns of the windows, by the
+	// coordinates of their middle cell and their height.
+	columns := map[[3]int][]int{}
+	column := func(x, y, height int, middle bool) []int {
+		key := [3]int{x, y, height}
+		if c, ok := columns[key]; ok && middle {
+			return c
+		}
+		var lits []int
+		for dy := -height; dy <= height; dy++ {
+			if dy != 0 || middle {
+				lits = append(lits, cell(x, y+dy))
+			}
+		}
+		c := f.Sum(lits)
+		if middle {
+			columns[key] = c
+		}
+		return c
+	}
+	for y := 0; y < int(h); y++ {
+		for x := 0; x < int(w); x++ {
+			var sums [][]int
+			for dx := -r.Range; dx <= r.Range; dx++ {
+				sums = append(sums, column(x+dx, y, r.height(dx), dx != 0 || r.Middle))
+			}
+			count := f.SumNumbers(sums)
+			st, err := target.Get(uint(x), uint(y))
+			if err != nil {
+				return nil, fmt.Errorf("cannot read the target: %v", err)
+			}
+			c := cnf.Var(w, uint(x), uint(y))
+			for v := 0; v <= r.Size(); v++ {
+				if r.next(true, v) != st.IsAlive() {
+					f.NotEqual(count, v, -c)
+				}
+				if r.next(false, v) != st.IsAlive() {
+					f.NotEqual(count, v, c)
+				}
+			}
+		}
+	}
+	return f, nil
+}
+
+// Solve searches for a parent of the target under the rule with the built-in SAT solver.
+//
+// It returns nil and no error iff the target has no parents.
+func Solve(target *grid.Grid, r *Rule) (*grid.Grid, error) {
+	f, err := Encode(target, r)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode the target: %v", err)
+	}
+	s := sat.New(f.NumVars)
+	for _, clause := range f.Clauses {
+		ok, err := s.AddClause(clause)
+		if err != nil {
+			return nil, fmt.Errorf("cannot add a clause: %v", err)
+		}
+		if !ok {
+			return nil, nil
+		}
+	}
+	if !s.Solve() {
+		return nil, nil
+	}
+	w, h := target.Width(), target.Height()
+	parent := target.Blank()
+	for y := uint(0); y < h; y++ {
+		for x := uint(0); x < w; x++ {
+			if err := parent.Set(x, y, state.Of(s.Value(cnf.Var(w, x, y)))); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return parent, nil
+}
+
+// Check verifies that the parent evolves into the target in one step under the rule.
+//
+// The parent is stepped with the topology of the target, whatever its own.
+func Check(parent, target *grid.Grid, r *Rule) error {
+	if parent.Width() != target.Width() || parent.Height() != target.Height() {
+		return fmt.Errorf("the parent is %dx%d, but the target is %dx%d", parent.Width(), parent.Height(), target.Width(), target.Height())
+	}
+	parent = parent.Copy()
+	parent.SetTopology(target.Topology())
+	next, err := r.Step(parent)
+	if err != nil {
+		return err
+	}
+	for y := uint(0); y < target.Height(); y++ {
+		for x := uint(0); x < target.Width(); x++ {
+			got, _ := next.Get(x, y)
+			want, _ := target.Get(x, y)
+			if got != want {
+				return fmt.Errorf("cell (%d, %d) evolves into %s, want %s", x, y, got.ToStr(), want.ToStr())
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ltl
+
+import (
+	"testing"
+
+	"github.com/pawelz/efilfoemag/src/grid"
+)
+
+func parseGrid(input string, t *testing.T) *grid.Grid {
+	t.Helper()
+	g, err := grid.Parse([]byte(input))
+	if err != nil {
+		t.Fatalf("cannot parse testdata: %v", err)
+	}
+	return g
+}
+
+func TestParseRule(t *testing.T) {
+	for _, td := range []struct {
+		input string
+		name  string
+		size  int
+	}{
+		{input: "R5,C0,M1,S34..58,B34..45,NM", name: "R5,C0,M1,S34..58,B34..45,NM", size: 121},
+		{input: "r5,c2,m1,s34..58,b34..45,nm", name: "R5,C0,M1,S34..58,B34..45,NM", size: 121},
+		{input: "B3,S2..3,R1", name: "R1,C0,M0,S2..3,B3..3,NM", size: 8},
+		{input: "R2,M1,S1..5,B2..3,NN", name: "R2,C0,M1,S1..5,B2..3,NN", size: 13},
+		{input: "R3,M0,S0..0,B1..24,NN", name: "R3,C0,M0,S0..0,B1..24,NN", size: 24},
+	} {
+		t.Run(td.input, func(t *testing.T) {
+			if !IsRule(td.input) {
+				t.Errorf("expected a Larger than Life rule")
+			}
+			r, err := ParseRule(td.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if r.String() != td.name {
+				t.Errorf("expected name %q, got %q", td.name, r.String())
+			}
+			if r.Size() != td.size {
+				t.Errorf("expected %d cells in a window, got %d", td.size, r.Size())
+			}
+		})
+	}
+	for _, input := range []string{"", "R0,S1,B1", "R1,S1", "R1,S1,B1,B2", "R1,C3,S1,B1", "R1,M2,S1,B1", "R1,S3..2,B1", "R1,S1..9,B1", "R1,S1,B1,NX", "R1,S1,B1,X1", "R1,S1,B1,"} {
+		t.Run(input, func(t *testing.T) {
+			if r, err := ParseRule(input); err == nil {
+				t.Errorf("expected an error, got %v", r)
+			}
+		})
+	}
+	if IsRule("B3/S23") {
+		t.Errorf("B3/S23 is not a Larger than Life rule")
+	}
+}
+
+func TestStep(t *testing.T) {
+	// With range 1 and the middle cell left out, the rule is Conway's.
+	conway, err := ParseRule("R1,C0,M0,S2..3,B3..3,NM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := parseGrid(`16x8
+#+##++###+##++##
+#++++##+#++++##+
+#++##+#+#++##+#+
++##+#++++##+#+++
+++###+##++###+##
+++++###+++++###+
+++++##++++++##++
+#+++##++#+++##++
+`, t)
+	for _, topology := range []grid.Topology{grid.Torus, grid.Plane, grid.KleinBottle} {
+		t.Run(topology.String(), func(t *testing.T) {
+			g.SetTopology(topology)
+			want, err := g.Step()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := conway.Step(g)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.EqualsTo(want) {
+				t.Errorf("expected:\n%s\ngot:\n%s", want.ToEfil(), got.ToEfil())
+			}
+		})
+	}
+	// Every cell of a range 2 diamond around a single cell is born, and the
+	// cell itself survives.
+	bloom, err := ParseRule("R2,C0,M0,S0..0,B1..1,NN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := bloom.Step(parseGrid(`8x8 plane
+++++++++
+++++++++
+++++++++
+++++#+++
+++++++++
+++++++++
+++++++++
+++++++++
+`, t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `8x8 plane
+++++++++
+++++#+++
++++###++
+++#####+
++++###++
+++++#+++
+++++++++
+++++++++
+`
+	if string(got.ToEfil()) != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got.ToEfil())
+	}
+}
+
+func TestSolve(t *testing.T) {
+	parent := `16x8
+#+##++###+##++##
+#++++##+#++++##+
+#++##+#+#++##+#+
++##+#++++##+#+++
+++###+##++###+##
+++++###+++++###+
+++++##++++++##++
+#+++##++#+++##++
+`
+	for _, td := range []struct {
+		rule     string
+		topology grid.Topology
+	}{
+		{rule: "R1,C0,M0,S2..3,B3..3,NM", topology: grid.Torus},
+		{rule: "R2,C0,M1,S6..10,B5..7,NM", topology: grid.Torus},
+		{rule: "R2,C0,M1,S6..10,B5..7,NM", topology: grid.Plane},
+		{rule: "R2,C0,M0,S3..6,B4..5,NN", topology: grid.Cylinder},
+	} {
+		t.Run(td.rule+"/"+td.topology.String(), func(t *testing.T) {
+			r, err := ParseRule(td.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := parseGrid(parent, t)
+			p.SetTopology(td.topology)
+			target, err := r.Step(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Solve(target, r)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got == nil {
+				t.Fatalf("want a parent, got none")
+			}
+			if err := Check(got, target, r); err != nil {
+				t.Errorf("invalid parent:\n%s\n%v", got.ToEfil(), err)
+			}
+		})
+	}
+}
+
+func TestSolveGardenOfEden(t *testing.T) {
+	// With range 1 and the middle cell left out, the rule is Conway's, under
+	// which a torus full of living cells has no parents.
+	conway, err := ParseRule("R1,C0,M0,S2..3,B3..3,NM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := parseGrid(`8x8
+########
+########
+########
+########
+########
+########
+########
+########
+`, t)
+	got, err := Solve(target, conway)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != nil {
+		t.Errorf("expected no parents, got:\n%s", got.ToEfil())
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package neighborhood
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// TableSize is the size in bytes of a raw rule table, see ParseTable.
+const TableSize = 0x200 / 8
+
+// ParseTable returns the rule given by a raw table of 512 bits.
+//
+// Bit n of the table, counting from the most significant bit of the first
+// byte, tells whether the neighborhood n evolves into a living cell. This is
+// the table encoded by the MAP rulestrings. The rule is named after its MAP
+// rulestring.
+func ParseTable(table []byte) (*Rule, error) {
+	if len(table) != TableSize {
+		return nil, fmt.Errorf("invalid rule table: want %d bytes, got %d", TableSize, len(table))
+	}
+	return NewRule("MAP"+encodeMAP(table), func(n Neighborhood) bool {
+		return table[n/8]&(0x80>>(n%8)) != 0
+	}), nil
+}
+
+// parseMAP parses a MAP rulestring, e.g. "MAPARYXfhZofugWaH7oaIDogBZofuhogOiAaIDogIAAgAAWaH7oaIDogGiA6ICAAIAAaIDogIAAgACAAIAAAAAAAA".
+//
+// The rule table, see ParseTable, is encoded in base64 after "MAP". The
+// padding at the end is optional.
+func parseMAP(s string) (*Rule, error) {
+	table, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(strings.TrimPrefix(s, "MAP"), "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid MAP rule %q: %v", s, err)
+	}
+	r, err := ParseTable(table)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MAP rule %q: %v", s, err)
+	}
+	return r, nil
+}
+
+// encodeMAP returns the base64 encoding of the table used by MAP rulestrings, without padding.
+func encodeMAP(table []byte) string {
+	return base64.RawStdEncoding.EncodeToString(table)
+}
+
+// Table returns the raw table of the rule, see ParseTable.
+func (r *Rule) Table() []byte {
+	rv := make([]byte, TableSize)
+	for n, alive := range r.alive {
+		if alive {
+			rv[n/8] |= 0x80 >> uint(n%8)
+		}
+	}
+	return rv
+}
+
+// MAP returns the MAP rulestring of the rule.
+func (r *Rule) MAP() string {
+	return "MAP" + encodeMAP(r.Table())
+}
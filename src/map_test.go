@@ -0,0 +1,80 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package neighborhood
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseMAP(t *testing.T) {
+	for _, td := range []struct {
+		name     string
+		input    string
+		expected *Rule
+	}{
+		{
+			name:     "conway",
+			input:    "MAPARYXfhZofugWaH7oaIDogBZofuhogOiAaIDogIAAgAAWaH7oaIDogGiA6ICAAIAAaIDogIAAgACAAIAAAAAAAA",
+			expected: Conway,
+		},
+		{
+			name:     "padded",
+			input:    "MAPARYXfhZofugWaH7oaIDogBZofuhogOiAaIDogIAAgAAWaH7oaIDogGiA6ICAAIAAaIDogIAAgACAAIAAAAAAAA==",
+			expected: Conway,
+		},
+		{
+			name:     "highlife",
+			input:    mustParseRule("B36/S23").MAP(),
+			expected: mustParseRule("B36/S23"),
+		},
+		{
+			name:     "hensel",
+			input:    mustParseRule("B2-a/S12").MAP(),
+			expected: mustParseRule("B2-a/S12"),
+		},
+		{
+			name:  "north",
+			input: NewRule("north", func(n Neighborhood) bool { return n.N().IsAlive() }).MAP(),
+			expected: NewRule("north", func(n Neighborhood) bool {
+				return n.N().IsAlive()
+			}),
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			r, err := ParseRule(td.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !bytes.Equal(r.Table(), td.expected.Table()) {
+				t.Errorf("expected the table of %s, got %x", td.expected, r.Table())
+			}
+			if !Equals(r.AncestorsOfAlive(), td.expected.AncestorsOfAlive()) {
+				t.Errorf("expected the ancestors of %s, got %v", td.expected, r.AncestorsOfAlive())
+			}
+			if back, err := ParseTable(r.Table()); err != nil || back.String() != r.String() {
+				t.Errorf("expected %s back from the table, got %v (%v)", r, back, err)
+			}
+		})
+	}
+
+	for _, input := range []string{"MAP", "MAPARYX", "MAP!RYXfhZofugWaH7oaIDogBZofuhogOiAaIDogIAAgAAWaH7oaIDogGiA6ICAAIAAaIDogIAAgACAAIAAAAAAAA", "MAPARYXfhZofugWaH7oaIDogBZofuhogOiAaIDogIAAgAAWaH7oaIDogGiA6ICAAIAAaIDogIAAgACAAIAAAAAAAAAAAA"} {
+		t.Run(input, func(t *testing.T) {
+			if r, err := ParseRule(input); err == nil {
+				t.Errorf("expected an error, got %v", r)
+			}
+		})
+	}
+}
@@ -49,42 +49,34 @@ const (
 )
 
 var (
-	ancestorsOfAlive = &Set{}
-	ancestorsOfDead  = &Set{}
-	sides            = []Side{NW, N, NE, W, C, E, SW, S, SE}
+	sides = []Side{NW, N, NE, W, C, E, SW, S, SE}
 )
 
-func init() {
-	var n Neighborhood
-	for n = 0; n < 0x200; n++ {
-		isAlive := func() {
-			ancestorsOfAlive.Add(n)
-		}
-		isDead := func() {
-			ancestorsOfDead.Add(n)
-		}
-		sumbit := bits.Sum(uint16(n))
-		switch {
-		case n.C().IsAlive() && sumbit == 4:
-			isAlive()
-		case n.C().IsAlive() && sumbit == 3:
-			isAlive()
-		case !n.C().IsAlive() && sumbit == 3:
-			isAlive()
-		default:
-			isDead()
-		}
-	}
-}
-
-// GetAncestorsOfAlive returns a new instance of a set representing all ancestors of a living cell.
+// GetAncestorsOfAlive returns a new instance of a set representing all ancestors of a living cell under Conway.
 func GetAncestorsOfAlive() *Set {
-	return ancestorsOfAlive.Copy()
+	return Conway.AncestorsOfAlive()
 }
 
-// GetAncestorsOfDead returns a new instance of a set representing all ancestors of a dead cell.
+// GetAncestorsOfDead returns a new instance of a set representing all ancestors of a dead cell under Conway.
 func GetAncestorsOfDead() *Set {
-	return ancestorsOfDead.Copy()
+	return Conway.AncestorsOfDead()
+}
+
+// Sides returns all sides of the neighborhood, including C, in the reading order.
+func Sides() []Side {
+	return append([]Side{}, sides...)
+}
+
+// Offset returns the position of the side relative to the center of the neighborhood.
+//
+// The x axis goes east and the y axis goes south, the same way as in grid.Grid.
+func (s Side) Offset() (int, int) {
+	return 1 - int(s)%3, 1 - int(s)/3
+}
+
+// Opposite returns the side opposite to the given one, e.g. SE for NW.
+func (s Side) Opposite() Side {
+	return SE + NW - s
 }
 
 func (s Side) ToStr() string {
@@ -180,54 +172,9 @@ func (n *Neighborhood) Set(side Side, s state.State) {
 //       O#O        ###
 //
 // then it is true that n.Matches(k, 1, SW), and false for any other side and distance.
+// The cells compared are the ones the neighborhoods share, see Shape.Matches.
 func (n Neighborhood) Matches(k Neighborhood, dist int, s Side) (bool, error) {
-	if s == C {
-		return false, fmt.Errorf("C is not a valid side for matching neighborhoods")
-	}
-	var v bool
-	switch dist {
-	case 1:
-		switch s {
-		case NW:
-			v = n.NW() == k.C() && n.N() == k.E() && n.W() == k.S() && n.C() == k.SE()
-		case N:
-			v = n.NW() == k.W() && n.N() == k.C() && n.NE() == k.E() && n.W() == k.SW() && n.C() == k.S() && n.E() == k.SE()
-		case NE:
-			v = n.N() == k.W() && n.NE() == k.C() && n.C() == k.SW() && n.E() == k.S()
-		case W:
-			v = n.NW() == k.N() && n.N() == k.NE() && n.W() == k.C() && n.C() == k.E() && n.SW() == k.S() && n.S() == k.SE()
-		case E:
-			v = n.N() == k.NW() && n.NE() == k.N() && n.C() == k.W() && n.E() == k.C() && n.S() == k.SW() && n.SE() == k.S()
-		case SW:
-			v = n.W() == k.N() && n.C() == k.NE() && n.SW() == k.C() && n.S() == k.E()
-		case S:
-			v = n.W() == k.NW() && n.C() == k.N() && n.E() == k.NE() && n.SW() == k.W() && n.S() == k.C() && n.SE() == k.E()
-		case SE:
-			v = n.C() == k.NW() && n.E() == k.N() && n.S() == k.W() && n.SW() == k.C()
-		}
-	case 2:
-		switch s {
-		case NW:
-			v = n.NW() == k.SE()
-		case N:
-			v = n.NW() == k.SW() && n.N() == k.S() && n.NE() == k.SE()
-		case NE:
-			v = n.NE() == k.SW()
-		case W:
-			v = n.NW() == k.NE() && n.W() == k.E() && n.SW() == k.SE()
-		case E:
-			v = n.NE() == k.NW() && n.E() == k.W() && n.SE() == k.SW()
-		case SW:
-			v = n.SW() == k.NE()
-		case S:
-			v = n.SW() == k.NW() && n.S() == k.N() && n.SE() == k.NE()
-		case SE:
-			v = n.SE() == k.NW()
-		}
-	default:
-		return false, fmt.Errorf("want dist equal 1 or 2, got %d", dist)
-	}
-	return v, nil
+	return Moore.Matches(n, k, dist, s)
 }
 
 // Parse is a factory that produces a Neighborhood from a string.
@@ -265,6 +212,18 @@ func Parse(n string) (Neighborhood, error) {
 	return v, nil
 }
 
+// Transpose returns the neighborhood mirrored along the NW-SE diagonal.
+func (n Neighborhood) Transpose() Neighborhood {
+	var rv Neighborhood
+	for _, s := range sides {
+		ox, oy := s.Offset()
+		if n&(1<<uint(s)) != 0 {
+			rv |= 1 << uint(4-oy-3*ox)
+		}
+	}
+	return rv
+}
+
 // ToStr renders a Neighborhood as a human readable string.
 func (n Neighborhood) ToStr() string {
 	var v string
@@ -335,6 +294,24 @@ func (s *Set) IsEmpty() bool {
 	return true
 }
 
+// Size returns the number of elements of the Set.
+func (s *Set) Size() int {
+	var rv int
+	for _, v := range s {
+		rv += int(bits.Sum(uint16(v)))
+	}
+	return rv
+}
+
+// Elements returns all elements of the Set in the ascending order.
+func (s *Set) Elements() []Neighborhood {
+	var rv []Neighborhood
+	for ite := s.iterator(); ite.more(); ite.next() {
+		rv = append(rv, ite.get())
+	}
+	return rv
+}
+
 // setIterator implements an iterator over a Set.
 type setIterator struct {
 	s *Set
@@ -410,6 +387,37 @@ func (s *Set) String() string {
 	return rv
 }
 
+// SidePair is a pair of sides of two neighborhoods that are the same cell.
+type SidePair struct {
+	Left  Side
+	Right Side
+}
+
+// Overlap describes which cells two neighborhoods share.
+//
+// Both neighborhoods are reduced to keys made of the states of the cells they
+// share, listed in the same order. The neighborhoods match iff their keys are
+// equal.
+type Overlap struct {
+	keyN [0x200]uint16
+	keyK [0x200]uint16
+}
+
+// NewOverlap returns the Overlap of neighborhoods sharing the given pairs of cells.
+func NewOverlap(shared []SidePair) *Overlap {
+	o := &Overlap{}
+	for n := 0; n < 0x200; n++ {
+		var keyN, keyK uint16
+		for _, p := range shared {
+			keyN = keyN<<1 | uint16(n>>uint(p.Left))&1
+			keyK = keyK<<1 | uint16(n>>uint(p.Right))&1
+		}
+		o.keyN[n] = keyN
+		o.keyK[n] = keyK
+	}
+	return o
+}
+
 // ShiftIntersect performs "shift & intersect" operation.
 //
 // Given two sets of neighborhoods (left and right), tries to find all elements
@@ -418,21 +426,40 @@ func (s *Set) String() string {
 //
 // Returns two sets containing "overlapping" elements each of the inupt sets.
 func ShiftIntersect(left *Set, right *Set, s Side) (*Set, *Set, error) {
+	return ShiftIntersectAt(left, right, 1, s)
+}
+
+// ShiftIntersectAt performs "shift & intersect" operation at the given distance.
+//
+// This is ShiftIntersect generalized to the neighborhoods at distance 2, with
+// the same meaning of dist and s as in Matches.
+func ShiftIntersectAt(left *Set, right *Set, dist int, s Side) (*Set, *Set, error) {
+	return Moore.ShiftIntersect(left, right, dist, s)
+}
+
+// IntersectOverlap removes the neighborhoods that match no neighborhood of the other set.
+//
+// This is ShiftIntersectAt generalized to any Overlap. Returns two sets
+// containing the matching elements of each of the input sets.
+func IntersectOverlap(left *Set, right *Set, o *Overlap) (*Set, *Set, error) {
+	var keysL, keysR [0x200]bool
+	for iteR := right.iterator(); iteR.more(); iteR.next() {
+		keysR[o.keyK[iteR.get()]] = true
+	}
 	resL := &Set{}
-	resR := &Set{}
 	for iteL := left.iterator(); iteL.more(); iteL.next() {
-		for iteR := right.iterator(); iteR.more(); iteR.next() {
-			match, err := iteL.get().Matches(iteR.get(), 1, s)
-			if err != nil {
-				return nil, nil, fmt.Errorf("ShiftIntersect Matches: %v", err)
+		if k := o.keyN[iteL.get()]; keysR[k] {
+			keysL[k] = true
+			if err := resL.Add(iteL.get()); err != nil {
+				return nil, nil, fmt.Errorf("IntersectOverlap resL.Add: %v", err)
 			}
-			if match {
-				if err := resL.Add(iteL.get()); err != nil {
-					return nil, nil, fmt.Errorf("ShiftIntersect resL.Add: %v", err)
-				}
-				if err := resR.Add(iteR.get()); err != nil {
-					return nil, nil, fmt.Errorf("ShiftIntersect resR.Add: %v", err)
-				}
+		}
+	}
+	resR := &Set{}
+	for iteR := right.iterator(); iteR.more(); iteR.next() {
+		if keysL[o.keyK[iteR.get()]] {
+			if err := resR.Add(iteR.get()); err != nil {
+				return nil, nil, fmt.Errorf("IntersectOverlap resR.Add: %v", err)
 			}
 		}
 	}
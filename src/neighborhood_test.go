@@ -921,6 +921,16 @@ func TestMatches(t *testing.T) {
 			matchesDist1: []Side{NW, N, NE},
 			matchesDist2: []Side{NW, N, NE, W, E, SW, S, SE},
 		},
+		{
+			n: `+++
+			    +++
+					#++`,
+			k: `+++
+			    +++
+					+++`,
+			matchesDist1: []Side{NW, N, NE, E, SE},
+			matchesDist2: []Side{NW, N, NE, E, SE},
+		},
 	} {
 		matchSet := map[int]map[Side]bool{
 			1: make(map[Side]bool),
@@ -971,7 +981,7 @@ func TestAncestors(t *testing.T) {
 	t.Run("ancestors of alive", func(t *testing.T) {
 		var counter int
 
-		for iter := ancestorsOfAlive.iterator(); iter.more(); iter.next() {
+		for iter := Conway.ancestorsOfAlive.iterator(); iter.more(); iter.next() {
 			counter++
 		}
 
@@ -985,7 +995,7 @@ func TestAncestors(t *testing.T) {
 	t.Run("ancestors of alive", func(t *testing.T) {
 		var counter int
 
-		for iter := ancestorsOfDead.iterator(); iter.more(); iter.next() {
+		for iter := Conway.ancestorsOfDead.iterator(); iter.more(); iter.next() {
 			counter++
 		}
 
@@ -1198,6 +1208,44 @@ func TestShiftIntersect(t *testing.T) {
 	}
 }
 
+func TestShiftIntersectAt(t *testing.T) {
+	// ShiftIntersectAt must agree with the pairwise Matches on any pair of sets.
+	left := parseList([]string{"+#+,++#,#++", "++#,++#,##+", "###,###,###", "+++,+++,+++", "#+#,+#+,#+#"}, t)
+	right := parseList([]string{"#++,+##,+++", "+##,+#+,#+#", "+++,+++,+++", "###,+++,###", "#+#,#+#,#+#"}, t)
+	for _, dist := range []int{1, 2} {
+		for _, side := range []Side{NW, N, NE, W, E, SW, S, SE} {
+			t.Run(fmt.Sprintf("dist=%d,side=%s", dist, side.ToStr()), func(t *testing.T) {
+				wantL, wantR := &Set{}, &Set{}
+				for _, n := range left.Elements() {
+					for _, k := range right.Elements() {
+						match, err := n.Matches(k, dist, side)
+						if err != nil {
+							t.Fatal(err)
+						}
+						if match {
+							wantL.Add(n)
+							wantR.Add(k)
+						}
+					}
+				}
+				gotL, gotR, err := ShiftIntersectAt(left, right, dist, side)
+				if err != nil {
+					t.Fatalf("ShiftIntersectAt returned error: %v", err)
+				}
+				if !Equals(wantL, gotL) {
+					t.Errorf("the left set is invalid: want %v, got %v", wantL, gotL)
+				}
+				if !Equals(wantR, gotR) {
+					t.Errorf("the right set is invalid: want %v, got %v", wantR, gotR)
+				}
+			})
+		}
+	}
+	if _, _, err := ShiftIntersectAt(left, right, 3, N); err == nil {
+		t.Errorf("expected a failure for dist = 3")
+	}
+}
+
 func TestSetCopy(t *testing.T) {
 	for _, td := range []struct{
 		name string
@@ -1236,3 +1284,30 @@ func TestSetCopy(t *testing.T) {
 		})
 	}
 }
+
+func TestTranspose(t *testing.T) {
+	for _, td := range []struct {
+		n        string
+		expected string
+	}{
+		{n: "+++,+++,+++", expected: "+++,+++,+++"},
+		{n: "#++,+#+,++#", expected: "#++,+#+,++#"},
+		{n: "+#+,+++,+++", expected: "+++,#++,+++"},
+		{n: "++#,+++,#++", expected: "++#,+++,#++"},
+		{n: "+++,++#,+#+", expected: "+++,++#,+#+"},
+		{n: "##+,+++,+++", expected: "#++,#++,+++"},
+	} {
+		t.Run(td.n, func(t *testing.T) {
+			n, err := Parse(td.n)
+			if err != nil {
+				t.Fatalf("cannot parse testdata: %v", err)
+			}
+			if got := n.Transpose().ToStr(); got != td.expected {
+				t.Errorf("expected %s, got %s", td.expected, got)
+			}
+			if back := n.Transpose().Transpose(); back != n {
+				t.Errorf("expected %s transposed twice, got %s", td.n, back.ToStr())
+			}
+		})
+	}
+}
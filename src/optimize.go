@@ -0,0 +1,151 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package solver
+
+import (
+	"fmt"
+
+	"github.com/pawelz/efilfoemag/src/cnf"
+	"github.com/pawelz/efilfoemag/src/grid"
+	"github.com/pawelz/efilfoemag/src/sat"
+)
+
+// Objective tells Optimize which parent to look for.
+type Objective int
+
+const (
+	// MinPopulation asks for a parent with as few living cells as possible.
+	MinPopulation Objective = iota
+	// MaxPopulation asks for a parent with as many living cells as possible.
+	MaxPopulation
+)
+
+// ObjectiveByName returns the objective called "min" or "max".
+func ObjectiveByName(name string) (Objective, error) {
+	switch name {
+	case "min":
+		return MinPopulation, nil
+	case "max":
+		return MaxPopulation, nil
+	}
+	return 0, fmt.Errorf("unknown objective %q, want min or max", name)
+}
+
+// Optimum is an optimal parent, together with the proof of its optimality.
+type Optimum struct {
+	// Parent is an optimal parent, or nil if the target is a Garden of Eden.
+	Parent *grid.Grid
+	// Population is the number of living cells of the Parent.
+	Population int
+	// Improvements is the number of ever better parents found on the way.
+	Improvements int
+	// Proof is a formula satisfied exactly by the parents better than the
+	// Parent, see cnf.Encode. Optimize proves it unsatisfiable, and it can be
+	// verified independently with any SAT solver.
+	Proof *cnf.Formula
+}
+
+// costLiterals returns the literals true for the parent cells that add to the cost.
+//
+// The cost is the number of living cells for MinPopulation, and the number of
+// dead cells for MaxPopulation, so it is always minimized.
+func costLiterals(w, h uint, objective Objective) []int {
+	var rv []int
+	for y := uint(0); y < h; y++ {
+		for x := uint(0); x < w; x++ {
+			v := cnf.Var(w, x, y)
+			if objective == MaxPopulation {
+				v = -v
+			}
+			rv = append(rv, v)
+		}
+	}
+	return rv
+}
+
+// Optimize returns a parent of the target with the minimal or maximal number of living cells.
+//
+// Rather than branching on the cells itself, Optimize leaves the branching to
+// the SAT strategy and bounds it from the outside: it is a linear search from
+// the cost of the first parent found down to the optimum. The first parent
+// is found with the formula of cnf.Encode alone. Then the formula is extended
+// with a counter of the cells adding to the cost, up to the cost of that
+// parent, so the counter has w*h times that many variables rather than
+// (w*h)^2, and every parent found bounds the cost of the next one. The search
+// ends when the SAT solver proves that no parent beats the last one, which is
+// the costly part on large grids.
+func Optimize(target *grid.Grid, objective Objective) (*Optimum, error) {
+	w, h := target.Width(), target.Height()
+	f, err := cnf.Encode(target)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode the target: %v", err)
+	}
+	proof := &cnf.Formula{NumVars: f.NumVars, Clauses: append([][]int{}, f.Clauses...)}
+	lits := costLiterals(w, h, objective)
+	rv := &Optimum{Proof: proof}
+	// improve reads the parent found by the SAT solver, and returns its cost.
+	improve := func(s *sat.Solver) (int, error) {
+		parent, err := satParent(s, target)
+		if err != nil {
+			return 0, err
+		}
+		var cost int
+		for _, l := range lits {
+			if l > 0 && s.Value(l) || l < 0 && !s.Value(-l) {
+				cost++
+			}
+		}
+		rv.Parent = parent
+		rv.Improvements++
+		rv.Population = cost
+		if objective == MaxPopulation {
+			rv.Population = len(lits) - cost
+		}
+		return cost, nil
+	}
+	s, ok, err := loadSATSolver(f)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || !s.Solve() {
+		return rv, nil
+	}
+	cost, err := improve(s)
+	if err != nil {
+		return nil, err
+	}
+	if cost > 0 {
+		outputs := f.Counter(lits, cost)
+		if s, ok, err = loadSATSolver(f); err != nil {
+			return nil, err
+		}
+		for ok {
+			if ok, err = s.AddClause([]int{-outputs[cost-1]}); err != nil {
+				return nil, fmt.Errorf("cannot bound the cost: %v", err)
+			}
+			if !ok || !s.Solve() {
+				break
+			}
+			if cost, err = improve(s); err != nil {
+				return nil, err
+			}
+			if cost == 0 {
+				break
+			}
+		}
+	}
+	proof.AtMost(lits, cost-1)
+	return rv, nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package solver
+
+import (
+	"testing"
+
+	"github.com/pawelz/efilfoemag/src/sat"
+)
+
+func TestOptimize(t *testing.T) {
+	blank := `8x8
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+`
+	glider := `8x8
+++++++++
++++#++++
+++++#+++
+++###+++
+++++++++
+++++++++
+++++++++
+++++++++
+`
+	for _, td := range []struct {
+		name       string
+		target     string
+		objective  Objective
+		population int
+		orphan     bool
+	}{
+		{
+			name:       "blank, min",
+			target:     blank,
+			objective:  MinPopulation,
+			population: 0,
+		},
+		{
+			name:       "blank, max",
+			target:     blank,
+			objective:  MaxPopulation,
+			population: 64,
+		},
+		{
+			name:       "glider, min",
+			target:     glider,
+			objective:  MinPopulation,
+			population: 5,
+		},
+		{
+			name: "orphan",
+			target: `8x8
+########
+########
+########
+########
+########
+########
+########
+########
+`,
+			objective: MinPopulation,
+			orphan:    true,
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			target := parseGrid(td.target, t)
+			got, err := Optimize(target, td.objective)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if td.orphan {
+				if got.Parent != nil {
+					t.Errorf("want no parents, got:\n%s", got.Parent.ToEfil())
+				}
+			} else {
+				if got.Parent == nil {
+					t.Fatalf("want a parent, got none")
+				}
+				if err := Check(got.Parent, target); err != nil {
+					t.Errorf("invalid parent:\n%s\n%v", got.Parent.ToEfil(), err)
+				}
+				var population int
+				for y := uint(0); y < got.Parent.Height(); y++ {
+					for x := uint(0); x < got.Parent.Width(); x++ {
+						if s, _ := got.Parent.Get(x, y); s.IsAlive() {
+							population++
+						}
+					}
+				}
+				if population != got.Population {
+					t.Errorf("the parent has %d living cells, but the reported population is %d", population, got.Population)
+				}
+				if got.Population != td.population {
+					t.Errorf("want population %d, got %d", td.population, got.Population)
+				}
+			}
+			s := sat.New(got.Proof.NumVars)
+			for _, clause := range got.Proof.Clauses {
+				if _, err := s.AddClause(clause); err != nil {
+					t.Fatalf("invalid proof: %v", err)
+				}
+			}
+			if s.Solve() {
+				t.Errorf("want an unsatisfiable proof, got a model")
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grid
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/pawelz/efilfoemag/src/neighborhood"
+	"github.com/pawelz/efilfoemag/src/state"
+)
+
+// DontCare is the symbol of a cell whose state is not fixed in a Pattern.
+const DontCare = '?'
+
+// Pattern is a Grid in which only some of the cells have fixed states.
+//
+// The other cells are "don't care": any state will do.
+type Pattern struct {
+	cells *Grid
+	fixed *Grid
+}
+
+// NewPattern returns a Pattern with all the cells of the grid fixed.
+func NewPattern(g *Grid) *Pattern {
+	fixed := &Grid{
+		width:  g.width,
+		height: g.height,
+		b:      make([]uint8, len(g.b)),
+	}
+	for y := uint(0); y < g.height; y++ {
+		for x := uint(0); x < g.width; x++ {
+			fixed.b[fixed.byteshift(x, y)] |= bitmask(x)
+		}
+	}
+	return &Pattern{cells: g.Copy(), fixed: fixed}
+}
+
+// ParsePattern parses the content of .efil file in which some cells may be DontCare.
+func ParsePattern(inputData []byte) (*Pattern, error) {
+	cells, fixed, err := parse(inputData, true)
+	if err != nil {
+		return nil, err
+	}
+	return &Pattern{cells: cells, fixed: fixed}, nil
+}
+
+// Width returns the width of the pattern.
+func (p *Pattern) Width() uint {
+	return p.cells.width
+}
+
+// Height returns the height of the pattern.
+func (p *Pattern) Height() uint {
+	return p.cells.height
+}
+
+// Topology returns the topology of the pattern.
+func (p *Pattern) Topology() Topology {
+	return p.cells.Topology()
+}
+
+// Rule returns the rule of the pattern.
+func (p *Pattern) Rule() *neighborhood.Rule {
+	return p.cells.Rule()
+}
+
+// CheckRelative returns an error unless the pattern is relative to its background, see Grid.CheckRelative.
+func (p *Pattern) CheckRelative() error {
+	return p.cells.CheckRelative()
+}
+
+// Get returns the state of the cell at the given address, and whether it is fixed.
+//
+// The state of a cell that is not fixed is Dead.
+func (p *Pattern) Get(x, y uint) (state.State, bool, error) {
+	isFixed, err := p.fixed.Get(x, y)
+	if err != nil {
+		return state.Dead, false, fmt.Errorf("cannot Get: %v", err)
+	}
+	if !isFixed.IsAlive() {
+		return state.Dead, false, nil
+	}
+	s, err := p.cells.Get(x, y)
+	return s, true, err
+}
+
+// Release makes the cell at the given address "don't care".
+func (p *Pattern) Release(x, y uint) error {
+	if err := p.cells.Set(x, y, state.Dead); err != nil {
+		return fmt.Errorf("cannot Release: %v", err)
+	}
+	return p.fixed.Set(x, y, state.Dead)
+}
+
+// NumFixed returns the number of fixed cells.
+func (p *Pattern) NumFixed() int {
+	var rv int
+	for y := uint(0); y < p.Height(); y++ {
+		for x := uint(0); x < p.Width(); x++ {
+			if _, isFixed, _ := p.Get(x, y); isFixed {
+				rv++
+			}
+		}
+	}
+	return rv
+}
+
+// Absolute returns the pattern relative to the given background in the terms of its cells, see Grid.Absolute.
+func (p *Pattern) Absolute(background state.State) *Pattern {
+	cells := p.cells.Absolute(background)
+	for i := range cells.b {
+		cells.b[i] &= p.fixed.b[i]
+	}
+	return &Pattern{cells: cells, fixed: p.fixed}
+}
+
+// ToEfil renders the pattern in the .efil format, with DontCare for the cells that are not fixed.
+func (p *Pattern) ToEfil() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(p.cells.header())
+	for y := uint(0); y < p.Height(); y++ {
+		for x := uint(0); x < p.Width(); x++ {
+			s, isFixed, _ := p.Get(x, y)
+			if isFixed {
+				buf.WriteRune(s.ToRune())
+			} else {
+				buf.WriteRune(DontCare)
+			}
+		}
+		buf.WriteByte(endl)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,98 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grid
+
+import (
+	"testing"
+
+	"github.com/pawelz/efilfoemag/src/state"
+)
+
+func TestParsePattern(t *testing.T) {
+	input := `8x8
+????????
+???#????
+??#+#???
+????????
+????????
+????????
+????????
+#??????+
+`
+	p, err := ParsePattern([]byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, td := range []struct {
+		x, y     uint
+		expected state.State
+		fixed    bool
+	}{
+		{x: 0, y: 0},
+		{x: 3, y: 1, expected: state.Alive, fixed: true},
+		{x: 3, y: 2, expected: state.Dead, fixed: true},
+		{x: 0, y: 7, expected: state.Alive, fixed: true},
+		{x: 7, y: 7, expected: state.Dead, fixed: true},
+	} {
+		s, fixed, err := p.Get(td.x, td.y)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if s != td.expected || fixed != td.fixed {
+			t.Errorf("at (%d, %d) want %v, fixed = %v, got %v, fixed = %v", td.x, td.y, td.expected, td.fixed, s, fixed)
+		}
+	}
+	if got := p.NumFixed(); got != 6 {
+		t.Errorf("want 6 fixed cells, got %d", got)
+	}
+	if got := string(p.ToEfil()); got != input {
+		t.Errorf("want:\n%s\ngot:\n%s", input, got)
+	}
+	if _, err := Parse([]byte(input)); err == nil {
+		t.Errorf("expected Parse to reject don't care cells")
+	}
+}
+
+func TestRelease(t *testing.T) {
+	g, err := Parse([]byte(`8x8
+++++++++
++++#++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+`))
+	if err != nil {
+		t.Fatalf("cannot parse testdata: %v", err)
+	}
+	p := NewPattern(g)
+	if got := p.NumFixed(); got != 64 {
+		t.Errorf("want 64 fixed cells, got %d", got)
+	}
+	if err := p.Release(3, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s, fixed, _ := p.Get(3, 1); s != state.Dead || fixed {
+		t.Errorf("want a released cell, got %v, fixed = %v", s, fixed)
+	}
+	if s, _ := g.Get(3, 1); s != state.Alive {
+		t.Errorf("want the grid intact, got %v", s)
+	}
+	if err := p.Release(8, 0); err == nil {
+		t.Errorf("expected a failure out of range")
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package solver
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pawelz/efilfoemag/src/grid"
+	"github.com/pawelz/efilfoemag/src/neighborhood"
+)
+
+// Domains holds the candidate parent neighborhoods of every cell of a target grid.
+type Domains struct {
+	width  int
+	height int
+	sets   []*neighborhood.Set
+	// shares lists, for every cell, the other cells whose parent
+	// neighborhoods share some parent cells with its own.
+	shares [][]share
+}
+
+// share is a cell sharing some parent cells with another one.
+type share struct {
+	cell    int
+	overlap *neighborhood.Overlap
+}
+
+// NewDomains returns the initial Domains for the target.
+//
+// Every cell starts with all the ancestors of its state under the rule of the
+// target, see neighborhood.Rule.Ancestors. The parent cells are
+// resolved with the topology of the target, so the neighborhoods in which
+// a cell outside of the grid is alive, or in which two sides that are the
+// same cell have different states, are left out.
+func NewDomains(target *grid.Grid) (*Domains, error) {
+	return newDomains(target, nil)
+}
+
+// NewSymmetricDomains returns the initial Domains for the parents of the target invariant under the symmetry.
+//
+// It is NewDomains, but for the parent cells, which are replaced with their
+// representatives, see grid.Symmetry.Representative. So the candidates of
+// the symmetric cells are tied together: they share all their parent cells,
+// and every cell only keeps the neighborhoods in which the symmetric parent
+// cells have the same states. It returns an error if the symmetry does not
+// fit the target, see grid.Symmetry.Check.
+func NewSymmetricDomains(target *grid.Grid, symmetry *grid.Symmetry) (*Domains, error) {
+	if err := symmetry.Check(target); err != nil {
+		return nil, err
+	}
+	return newDomains(target, symmetry)
+}
+
+// newDomains implements NewDomains and NewSymmetricDomains. The symmetry is nil for NewDomains.
+func newDomains(target *grid.Grid, symmetry *grid.Symmetry) (*Domains, error) {
+	if err := target.CheckRelative(); err != nil {
+		return nil, err
+	}
+	w, h := int(target.Width()), int(target.Height())
+	d := &Domains{
+		width:  w,
+		height: h,
+		sets:   make([]*neighborhood.Set, w*h),
+		shares: make([][]share, w*h),
+	}
+	// parents[i][side] is the parent cell at the side of cell i, or -1 if it
+	// is outside of the grid, and users[c] lists the cells and sides at which
+	// the parent cell c is found.
+	type use struct {
+		cell int
+		side neighborhood.Side
+	}
+	// The sides outside of the neighborhood of the rule are always dead, the
+	// same as outside of the grid.
+	parents := make([][9]int, w*h)
+	users := make([][]use, w*h)
+	for i := range parents {
+		for _, side := range neighborhood.Sides() {
+			parents[i][side] = -1
+		}
+		for _, side := range target.Rule().Sides() {
+			dx, dy := side.Offset()
+			x, y, ok := target.Topology().Resolve(i%w+dx, i/w+dy, uint(w), uint(h))
+			if !ok {
+				continue
+			}
+			if symmetry != nil {
+				x, y = symmetry.Representative(x, y, uint(w), uint(h))
+			}
+			c := int(y)*w + int(x)
+			parents[i][side] = c
+			users[c] = append(users[c], use{cell: i, side: side})
+		}
+	}
+	overlaps := map[string]*neighborhood.Overlap{}
+	for i := range d.sets {
+		st, err := target.Get(uint(i%w), uint(i/w))
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the target: %v", err)
+		}
+		d.sets[i] = &neighborhood.Set{}
+		for _, n := range target.Rule().Ancestors(st).Elements() {
+			if consistent(n, parents[i]) {
+				d.sets[i].Add(n)
+			}
+		}
+
+		// A single pair of sides per shared parent cell is enough, as the
+		// sides that are the same cell already have the same state.
+		var cells []int
+		pairs := map[int][]neighborhood.SidePair{}
+		paired := map[[2]int]bool{}
+		for _, side := range neighborhood.Sides() {
+			if parents[i][side] == -1 {
+				continue
+			}
+			for _, u := range users[parents[i][side]] {
+				if u.cell == i || paired[[2]int{u.cell, parents[i][side]}] {
+					continue
+				}
+				paired[[2]int{u.cell, parents[i][side]}] = true
+				if pairs[u.cell] == nil {
+					cells = append(cells, u.cell)
+				}
+				pairs[u.cell] = append(pairs[u.cell], neighborhood.SidePair{Left: side, Right: u.side})
+			}
+		}
+		sort.Ints(cells)
+		for _, j := range cells {
+			key := fmt.Sprint(pairs[j])
+			if overlaps[key] == nil {
+				overlaps[key] = neighborhood.NewOverlap(pairs[j])
+			}
+			d.shares[i] = append(d.shares[i], share{cell: j, overlap: overlaps[key]})
+		}
+	}
+	return d, nil
+}
+
+// consistent returns true iff the neighborhood fits the given parent cells of its sides.
+//
+// The cells outside of the grid, marked with -1, must be dead, and the sides
+// that are the same cell must have the same state.
+func consistent(n neighborhood.Neighborhood, parents [9]int) bool {
+	for _, p := range neighborhood.Sides() {
+		if parents[p] == -1 {
+			if n>>uint(p)&1 != 0 {
+				return false
+			}
+			continue
+		}
+		for _, q := range neighborhood.Sides() {
+			if q < p && parents[q] == parents[p] && n>>uint(p)&1 != n>>uint(q)&1 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Width returns the width of the grid.
+func (d *Domains) Width() uint {
+	return uint(d.width)
+}
+
+// Height returns the height of the grid.
+func (d *Domains) Height() uint {
+	return uint(d.height)
+}
+
+// Get returns the candidate neighborhoods of the cell at the given address.
+func (d *Domains) Get(x, y uint) *neighborhood.Set {
+	return d.sets[int(y)*d.width+int(x)]
+}
+
+// IsEmpty returns true iff any cell has no candidates left.
+func (d *Domains) IsEmpty() bool {
+	for _, s := range d.sets {
+		if s.IsEmpty() {
+			return true
+		}
+	}
+	return false
+}
+
+// propagate prunes the candidates until no more can be removed.
+//
+// Pruning starts with the cells in the queue, and then spreads to every cell
+// whose candidates have changed. Every change is reported to replace before it
+// is made. It returns false iff some cell is left without candidates.
+func (d *Domains) propagate(queue []int, replace func(i int, s *neighborhood.Set)) (bool, error) {
+	queued := make([]bool, len(d.sets))
+	for _, i := range queue {
+		queued[i] = true
+	}
+	update := func(i int, s *neighborhood.Set) {
+		if neighborhood.Equals(s, d.sets[i]) {
+			return
+		}
+		replace(i, s)
+		d.sets[i] = s
+		if !queued[i] {
+			queue = append(queue, i)
+			queued[i] = true
+		}
+	}
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		queued[i] = false
+		for _, sh := range d.shares[i] {
+			left, right, err := neighborhood.IntersectOverlap(d.sets[i], d.sets[sh.cell], sh.overlap)
+			if err != nil {
+				return false, fmt.Errorf("cannot prune the neighbours of cell %d: %v", i, err)
+			}
+			if left.IsEmpty() || right.IsEmpty() {
+				return false, nil
+			}
+			update(i, left)
+			update(sh.cell, right)
+		}
+	}
+	return true, nil
+}
+
+// Propagate prunes the candidates of all cells until no more can be removed.
+//
+// Every cell is matched against the cells sharing some parent cells with it,
+// i.e. its neighbours at distance 1 and 2 on the torus, with
+// neighborhood.IntersectOverlap, and the candidates without a match are
+// removed. This never removes a neighborhood that is a part of some parent, so
+// if it returns false (some cell is left without candidates) the target is a
+// Garden of Eden.
+func Propagate(d *Domains) (bool, error) {
+	queue := make([]int, len(d.sets))
+	for i := range queue {
+		queue[i] = i
+	}
+	return d.propagate(queue, func(int, *neighborhood.Set) {})
+}
@@ -0,0 +1,132 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package solver
+
+import (
+	"testing"
+)
+
+func TestPropagate(t *testing.T) {
+	for _, td := range []struct {
+		name   string
+		target string
+		parent string
+		// Number of candidates left in every cell, if the same for all cells.
+		candidates int
+	}{
+		{
+			name: "blinker",
+			target: `8x8
+++++++++
+++++++++
+++++++++
+++###+++
+++++++++
+++++++++
+++++++++
+++++++++
+`,
+			parent: `8x8
+++++++++
+++++++++
++++#++++
++++#++++
++++#++++
+++++++++
+++++++++
+++++++++
+`,
+		},
+		{
+			name: "glider",
+			target: `8x8
+++++++++
++++#++++
+++++#+++
+++###+++
+++++++++
+++++++++
+++++++++
+++++++++
+`,
+			parent: `8x8
+++++++++
+++#+++++
++++##+++
+++##++++
+++++++++
+++++++++
+++++++++
+++++++++
+`,
+		},
+		{
+			name: "all alive",
+			target: `8x8
+########
+########
+########
+########
+########
+########
+########
+########
+`,
+			// The propagation alone cannot prove this one, but it removes 16 of
+			// the 140 ancestors of alive from every cell.
+			candidates: 124,
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			target := parseGrid(td.target, t)
+			d, err := NewDomains(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ok, err := Propagate(d)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !ok || d.IsEmpty() {
+				t.Fatalf("the propagation claims a Garden of Eden")
+			}
+			if td.candidates != 0 {
+				for y := uint(0); y < target.Height(); y++ {
+					for x := uint(0); x < target.Width(); x++ {
+						if got := d.Get(x, y).Size(); got != td.candidates {
+							t.Errorf("want %d candidates in cell (%d, %d), got %d", td.candidates, x, y, got)
+						}
+					}
+				}
+				return
+			}
+			parent := parseGrid(td.parent, t)
+			if err := Check(parent, target); err != nil {
+				t.Fatalf("invalid testdata: %v", err)
+			}
+			for y := uint(0); y < target.Height(); y++ {
+				for x := uint(0); x < target.Width(); x++ {
+					n, err := parent.Neighborhood(x, y)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if c, _ := d.Get(x, y).Contains(n); !c {
+						t.Errorf("the propagation removed %q from cell (%d, %d)", n.ToStr(), x, y)
+					}
+				}
+			}
+		})
+	}
+}
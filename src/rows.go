@@ -0,0 +1,439 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package solver
+
+import (
+	"fmt"
+	mathbits "math/bits"
+
+	"github.com/pawelz/efilfoemag/src/grid"
+	"github.com/pawelz/efilfoemag/src/neighborhood"
+	"github.com/pawelz/efilfoemag/src/state"
+)
+
+// MaxRowsLineLength is the longest line the Rows strategy accepts if the y edges are dead.
+//
+// The search keeps up to 2^(2*length) pairs of parent lines for every target
+// line. Longer lines are better left to the other strategies.
+const MaxRowsLineLength = 12
+
+// MaxRowsGluedLineLength is the longest line the Rows strategy accepts if the y edges are glued.
+//
+// The search then starts from 2^(2*length) anchors, see starts, and keeps up to
+// 2^(4*length) states for every target line. With 10-cell lines Rows solves a
+// target on a torus in about a second, and Count takes up to a few seconds, or
+// far longer for the targets with astronomically many parents.
+const MaxRowsGluedLineLength = 10
+
+// Rows is the transfer-matrix search, moving down the target one row at a time.
+//
+// The state of the search is the pair of the last two parent rows. If the top
+// and the bottom edges are glued, the state also carries its anchor, the first
+// and the last parent rows, which are needed to check the target rows next to
+// the edges at the end.
+//
+// The search goes depth first rather than keeping the whole frontier of the
+// states reachable after every target row: a target with many parents, e.g. a
+// blank torus, reaches almost all the anchored states, far too many to keep,
+// while going depth first stops at the first parent. The states which led
+// nowhere are remembered, so the work still grows with the number of distinct
+// states rather than with the number of partial parents, and so are the pairs
+// of rows which cannot reach the last row whatever the anchor, so the dead
+// ends are shared between all the anchors. Count does keep the frontier, see
+// lines.count.
+//
+// Rows supports the topologies gluing the opposite edges of the grid, as long
+// as the left and the right edges are dead or wrapped, i.e. all but
+// grid.ProjectivePlane. The work is exponential in the length of the rows, but
+// only linear in their number, so the grid is transposed first if it is wider
+// than it is tall and the topology allows it. On narrow grids this makes Rows a
+// good way to prove that the target has no parents.
+type Rows struct{}
+
+// edge tells what lies beyond an edge of the grid, see edges.
+type edge int
+
+const (
+	// deadEdge has only dead cells beyond it.
+	deadEdge edge = iota
+	// wrapEdge leads to the opposite edge.
+	wrapEdge
+	// flipEdge leads to the opposite edge, mirrored.
+	flipEdge
+	// otherEdge is none of the above.
+	otherEdge
+)
+
+// edges tells what lies beyond the x and the y edges of the grids of the topology.
+//
+// The topology is probed with a 3x3 grid, crossing each edge next to a corner.
+func edges(t grid.Topology) (x edge, y edge) {
+	probe := func(ox, oy int, wrapped, flipped [2]uint) edge {
+		rx, ry, ok := t.Resolve(ox, oy, 3, 3)
+		switch {
+		case !ok:
+			return deadEdge
+		case [2]uint{rx, ry} == wrapped:
+			return wrapEdge
+		case [2]uint{rx, ry} == flipped:
+			return flipEdge
+		}
+		return otherEdge
+	}
+	return probe(-1, 0, [2]uint{2, 0}, [2]uint{2, 2}), probe(0, -1, [2]uint{0, 2}, [2]uint{2, 2})
+}
+
+// lines is a grid stored as a list of lines. Bit x of a line is the cell x.
+type lines struct {
+	length int
+	mask   uint64
+	// xWrap tells whether the ends of the lines are glued together. If not,
+	// the cells beyond them are dead.
+	xWrap bool
+	// yEdge tells what lies beyond the first and the last line.
+	yEdge edge
+	// alive tells whether the cell evolves into a living one. It is indexed
+	// by the three-cell windows of the parent lines, see wrap, the northern
+	// one in the lowest bits.
+	alive [0x200]bool
+	// successorCache maps the pairs of parent lines and the target lines to
+	// their successors, see successors.
+	successorCache map[uint64][]uint64
+}
+
+// newLines returns the lines of the given length evolving with the rule.
+//
+// If transposed, the lines are the columns of the grid, so the rule is
+// applied to the transposed neighborhoods.
+func newLines(length int, xWrap bool, yEdge edge, rule *neighborhood.Rule, transposed bool) *lines {
+	l := &lines{
+		length: length,
+		mask:   1<<uint(length) - 1,
+		xWrap:  xWrap,
+		yEdge:  yEdge,
+
+		successorCache: map[uint64][]uint64{},
+	}
+	for n := neighborhood.Neighborhood(0); n < 0x200; n++ {
+		// The sides are in the reading order, so side i lands in the window
+		// of line i/3, at position i%3.
+		var idx int
+		for i, side := range neighborhood.Sides() {
+			if n>>uint(side)&1 != 0 {
+				idx |= 1 << uint(i)
+			}
+		}
+		if transposed {
+			l.alive[idx] = rule.Next(n.Transpose()).IsAlive()
+		} else {
+			l.alive[idx] = rule.Next(n).IsAlive()
+		}
+	}
+	return l
+}
+
+// toLines reads the rows of the grid as lines.
+func toLines(g *grid.Grid) ([]uint64, error) {
+	rv := make([]uint64, g.Height())
+	for y := range rv {
+		row, err := g.Row(uint(y))
+		if err != nil {
+			return nil, err
+		}
+		// The bytes hold the leftmost cell in the most significant bit.
+		for i, octet := range row {
+			rv[y] |= uint64(mathbits.Reverse8(octet)) << uint(8*i)
+		}
+	}
+	return rv, nil
+}
+
+// bit returns the bit x of the line.
+func (l *lines) bit(line uint64, x int) int {
+	return int(line>>uint(x)) & 1
+}
+
+// wrap returns the line with the wrapped cells added on both ends.
+//
+// Bit x+1 of the result is the cell x, bit 0 is the last cell and bit
+// length+1 is the first cell, so the three cells around x are (wrapped>>x)&7.
+// If the ends are not glued, bits 0 and length+1 are dead.
+func (l *lines) wrap(line uint64) uint64 {
+	if !l.xWrap {
+		return line << 1
+	}
+	return line<<1 | line>>uint(l.length-1) | line<<uint(l.length+1)
+}
+
+// reverse returns the line mirrored.
+func (l *lines) reverse(line uint64) uint64 {
+	var rv uint64
+	for x := 0; x < l.length; x++ {
+		rv = rv<<1 | line>>uint(x)&1
+	}
+	return rv
+}
+
+// beyond returns the parent line beyond the y edge next to the given line at the opposite edge.
+func (l *lines) beyond(line uint64) uint64 {
+	switch l.yEdge {
+	case deadEdge:
+		return 0
+	case flipEdge:
+		return l.reverse(line)
+	}
+	return line
+}
+
+// starts returns the frontier states the search starts from, before the first target line.
+//
+// A state is the pair of the last two parent lines, together with its
+// anchor: the guessed last line q and the first line p0, see anchored. The
+// search starts with the line beyond the first one, which follows from q, and
+// p0, and it is closed by the last two lines, see closes. If the y edges are
+// dead the line beyond the first one is dead whatever q, and the last line
+// closes the parent whatever p0, so the anchor is always 0 and all the
+// partial parents share a single frontier.
+func (l *lines) starts() []uint64 {
+	var rv []uint64
+	for p0 := uint64(0); p0 <= l.mask; p0++ {
+		if l.yEdge == deadEdge {
+			rv = append(rv, l.pair(0, p0))
+			continue
+		}
+		for q := uint64(0); q <= l.mask; q++ {
+			rv = append(rv, l.anchored(l.pair(q, p0), l.pair(l.beyond(q), p0)))
+		}
+	}
+	return rv
+}
+
+// anchored returns the frontier state of the given anchor and pair of lines, see starts.
+func (l *lines) anchored(anchor, pair uint64) uint64 {
+	return anchor<<uint(2*l.length) | pair
+}
+
+// unanchor splits the frontier state into its anchor and its pair of lines.
+func (l *lines) unanchor(state uint64) (uint64, uint64) {
+	return state >> uint(2*l.length), state & (1<<uint(2*l.length) - 1)
+}
+
+// next returns the frontier state following the given one with the parent line c.
+func (l *lines) next(state, c uint64) uint64 {
+	anchor, pair := l.unanchor(state)
+	_, b := l.unpair(pair)
+	return l.anchored(anchor, l.pair(b, c))
+}
+
+// closes checks whether the last two parent lines of the frontier state close the parent, see starts.
+func (l *lines) closes(t []uint64, state uint64) bool {
+	anchor, pair := l.unanchor(state)
+	q, p0 := l.unpair(anchor)
+	a, b := l.unpair(pair)
+	if l.yEdge != deadEdge && b != q {
+		return false
+	}
+	return l.lineOK(a, b, l.beyond(p0), t[len(t)-1])
+}
+
+// cellOK checks whether cell x of the target line t is consistent with the wrapped parent lines a, b and c.
+//
+// The lines a, b and c are the parent lines north of, at, and south of t.
+func (l *lines) cellOK(a, b, c, t uint64, x int) bool {
+	idx := (a>>uint(x))&7 | (b>>uint(x))&7<<3 | (c>>uint(x))&7<<6
+	return l.alive[idx] == (l.bit(t, x) == 1)
+}
+
+// lineOK checks whether the whole target line t is consistent with the parent lines a, b and c.
+func (l *lines) lineOK(a, b, c, t uint64) bool {
+	a, b, c = l.wrap(a), l.wrap(b), l.wrap(c)
+	for x := 0; x < l.length; x++ {
+		if !l.cellOK(a, b, c, t, x) {
+			return false
+		}
+	}
+	return true
+}
+
+// extend calls emit for every parent line c consistent with the target line t and the parent lines a and b.
+func (l *lines) extend(a, b, t uint64, emit func(c uint64)) {
+	wa, wb := l.wrap(a), l.wrap(b)
+	var rec func(c uint64, x int)
+	rec = func(c uint64, x int) {
+		// All the bits below x are set, so every cell up to x-2 can be checked,
+		// except for cell 0, which needs the last bit. Shifting c left makes
+		// it aligned with the wrapped lines.
+		if x >= 3 && !l.cellOK(wa, wb, c<<1, t, x-2) {
+			return
+		}
+		if x == l.length {
+			wc := l.wrap(c)
+			if l.cellOK(wa, wb, wc, t, 0) && l.cellOK(wa, wb, wc, t, l.length-1) {
+				emit(c)
+			}
+			return
+		}
+		rec(c, x+1)
+		rec(c|1<<uint(x), x+1)
+	}
+	rec(0, 0)
+}
+
+// pair packs two lines into a frontier state.
+func (l *lines) pair(a, b uint64) uint64 {
+	return a<<uint(l.length) | b
+}
+
+func (l *lines) unpair(p uint64) (uint64, uint64) {
+	return p >> uint(l.length), p & l.mask
+}
+
+// successors returns the parent lines consistent with the target line t after the pair of parent lines, see extend.
+//
+// The lines are cached, as the same pairs meet the same target lines many
+// times, in different layers of the search and with different anchors.
+func (l *lines) successors(pair, t uint64) []uint64 {
+	key := pair<<uint(l.length) | t
+	if rv, ok := l.successorCache[key]; ok {
+		return rv
+	}
+	a, b := l.unpair(pair)
+	var rv []uint64
+	l.extend(a, b, t, func(c uint64) {
+		rv = append(rv, c)
+	})
+	l.successorCache[key] = rv
+	return rv
+}
+
+// solve searches for a parent of the target lines.
+//
+// The search goes depth first through the frontier states, see starts,
+// starting with every anchor in turn. The states which failed are not
+// searched again, and neither are the pairs of lines that cannot be extended
+// to the last line at all, whatever the anchor, so the dead ends are shared
+// between all the partial parents. It returns the lines of the parent, or nil
+// if there is none.
+func (l *lines) solve(t []uint64) []uint64 {
+	n := len(t)
+	p := make([]uint64, n)
+	// failed[k] holds the states with the lines (p[k-1], p[k]) searched
+	// without finding a parent, and dead[k] the pairs of these lines which
+	// never reached the last line.
+	failed := make([]map[uint64]bool, n)
+	dead := make([]map[uint64]bool, n)
+	for k := range failed {
+		failed[k], dead[k] = map[uint64]bool{}, map[uint64]bool{}
+	}
+	// search returns whether the state leads to a parent, and whether it
+	// might reach the last line.
+	var search func(k int, state uint64) (bool, bool)
+	search = func(k int, state uint64) (bool, bool) {
+		_, pair := l.unanchor(state)
+		_, p[k] = l.unpair(pair)
+		if k == n-1 {
+			return l.closes(t, state), true
+		}
+		if dead[k][pair] {
+			return false, false
+		}
+		if failed[k][state] {
+			return false, true
+		}
+		reached := false
+		for _, c := range l.successors(pair, t[k]) {
+			found, r := search(k+1, l.next(state, c))
+			if found {
+				return true, true
+			}
+			reached = reached || r
+		}
+		failed[k][state] = true
+		if !reached {
+			dead[k][pair] = true
+		}
+		return false, reached
+	}
+	for _, state := range l.starts() {
+		if found, _ := search(0, state); found {
+			return p
+		}
+	}
+	return nil
+}
+
+// prepare turns the target into lines for Rows and Count.
+//
+// The target is transposed if it is wider than it is tall, and the topology
+// allows it. It returns the lines, the target lines, and whether the target
+// got transposed.
+func prepare(target *grid.Grid) (*lines, []uint64, bool, error) {
+	if target.Rule().States() > 2 {
+		return nil, nil, false, fmt.Errorf("the %s rule has dying states, which are not supported", target.Rule())
+	}
+	if err := target.CheckRelative(); err != nil {
+		return nil, nil, false, err
+	}
+	x, y := edges(target.Topology())
+	transposed := target.Width() > target.Height() && y != flipEdge && y != otherEdge
+	if transposed {
+		target = target.Transpose()
+		x, y = y, x
+	}
+	if x != deadEdge && x != wrapEdge || y == otherEdge {
+		return nil, nil, false, fmt.Errorf("the %s topology is not supported", target.Topology())
+	}
+	length, max := int(target.Width()), MaxRowsLineLength
+	if y != deadEdge {
+		max = MaxRowsGluedLineLength
+	}
+	if length > max {
+		return nil, nil, false, fmt.Errorf("the lines of the grid must be at most %d long under the %s topology, got %d", max, target.Topology(), length)
+	}
+	t, err := toLines(target)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("cannot read the target: %v", err)
+	}
+	return newLines(length, x == wrapEdge, y, target.Rule(), transposed), t, transposed, nil
+}
+
+// Solve implements Strategy.
+func (Rows) Solve(target *grid.Grid) (*grid.Grid, error) {
+	l, t, transposed, err := prepare(target)
+	if err != nil {
+		return nil, err
+	}
+	p := l.solve(t)
+	if p == nil {
+		return nil, nil
+	}
+	parent, err := grid.New(l.length, len(t))
+	if err != nil {
+		return nil, err
+	}
+	for y, line := range p {
+		for x := 0; x < l.length; x++ {
+			if err := parent.Set(uint(x), uint(y), state.Of(l.bit(line, x) == 1)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if transposed {
+		parent = parent.Transpose()
+	}
+	parent.SetTopology(target.Topology())
+	parent.SetRule(target.Rule())
+	return parent, nil
+}
@@ -0,0 +1,460 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package neighborhood
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pawelz/efilfoemag/src/state"
+)
+
+// Rule tells which neighborhoods evolve into living cells.
+//
+// The rules of the Generations family have more than two states: a living
+// cell which does not survive goes through the dying states, one generation
+// each, before it is dead. The dying cells neither count as living neighbours
+// nor give birth, so the rule table only applies to the dead and the living
+// cells.
+type Rule struct {
+	name   string
+	states int
+	// shape is the neighborhood the rule looks at. The other cells are
+	// always dead in the ancestors.
+	shape Shape
+	alive [0x200]bool
+	// base is the rule that a Relative rule is derived from, and background
+	// the background of the parents it evolves. base is nil for the other
+	// rules.
+	base       *Rule
+	background state.State
+	// relative caches the Relative rules, by the background. They are built
+	// once, as the rules are shared, e.g. Conway.
+	relative         [2]*Rule
+	relativeOnce     [2]sync.Once
+	ancestorsOfAlive *Set
+	ancestorsOfDead  *Set
+	// birth, survival and totalistic are the result of Totalistic, and
+	// offsets the one of NeighbourOffsets, computed once, as they are needed
+	// at every step of a grid.
+	birth, survival uint16
+	totalistic      bool
+	offsets         [][2]int
+}
+
+// Conway is the rule of the Game of Life, B3/S23. This is the default.
+var Conway = mustParseRule("B3/S23")
+
+// NewRule returns the rule of the given name, in which n evolves into a living cell iff alive(n).
+func NewRule(name string, alive func(n Neighborhood) bool) *Rule {
+	return newRule(name, Moore, alive)
+}
+
+// newRule returns the rule of the given name and shape, in which n evolves into a living cell iff alive(n).
+//
+// alive must ignore the cells outside of the shape.
+func newRule(name string, shape Shape, alive func(n Neighborhood) bool) *Rule {
+	r := &Rule{
+		name:             name,
+		states:           2,
+		shape:            shape,
+		ancestorsOfAlive: &Set{},
+		ancestorsOfDead:  &Set{},
+	}
+	for n := Neighborhood(0); n < 0x200; n++ {
+		r.alive[n] = alive(n)
+		if !shape.Contains(n) {
+			continue
+		}
+		if r.alive[n] {
+			r.ancestorsOfAlive.Add(n)
+		} else {
+			r.ancestorsOfDead.Add(n)
+		}
+	}
+	r.birth, r.survival, r.totalistic = r.countTotals()
+	for _, side := range shape.Sides() {
+		if side != C {
+			dx, dy := side.Offset()
+			r.offsets = append(r.offsets, [2]int{dx, dy})
+		}
+	}
+	return r
+}
+
+// ParseRule parses a Life-like rule in the B/S notation, e.g. "B36/S23".
+//
+// The digits after B are the numbers of living neighbours giving birth to a
+// dead cell, and the digits after S the ones letting a living cell survive.
+// The letters B and S are case-insensitive, and the parts may come in either
+// order. Every digit may be followed by the letters of the isotropic
+// non-totalistic Hensel notation, e.g. "B2-a/S12", to pick only some of the
+// arrangements of the neighbours, see HenselLetter. The letters after a minus
+// sign are excluded instead.
+//
+// A final H makes it a rule of the hexagonal neighborhood, see HexSides, in
+// which the digits are the numbers of the 6 hexagonal neighbours, e.g.
+// "B2/S34H". Likewise a final V makes it a rule of the VonNeumann
+// neighborhood, e.g. "B2/S013V", and N@ followed by a mask, see ParseShape,
+// one of any other Shape. The Hensel letters are only defined for the Moore
+// neighborhood.
+//
+// A third part, C followed by the number of states, e.g. "B2/S/C3", makes it
+// a Generations rule. Without the letters the parts are S, B and the number of
+// states, in this order, as in Golly: "/2/3" is the same rule, Brian's Brain.
+//
+// Any rule can also be given as a MAP rulestring, see ParseTable.
+func ParseRule(s string) (*Rule, error) {
+	if strings.HasPrefix(s, "MAP") {
+		return parseMAP(s)
+	}
+	rule, shape, err := parseShape(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rule %q: %v", s, err)
+	}
+	parse, classify := parseHensel, HenselLetter
+	if shape != Moore {
+		parse, classify = shape.parseCounts, shape.count
+	}
+	parts := strings.Split(rule, "/")
+	if len(parts) != 2 && len(parts) != 3 {
+		return nil, fmt.Errorf("invalid rule %q: want B and S parts, and optionally the number of states, separated by /", s)
+	}
+	var birth, survival *[9]map[byte]bool
+	var nameB, nameS string
+	states := 2
+	if numeric(parts) {
+		parts = append([]string{"S" + parts[0], "B" + parts[1]}, parts[2:]...)
+		if len(parts) == 3 {
+			parts[2] = "C" + parts[2]
+		}
+	}
+	for i, part := range parts {
+		var err error
+		switch upper := strings.ToUpper(part); {
+		case strings.HasPrefix(upper, "B") && birth == nil:
+			birth, nameB, err = parse(part[1:])
+		case strings.HasPrefix(upper, "S") && survival == nil:
+			survival, nameS, err = parse(part[1:])
+		case (strings.HasPrefix(upper, "C") || strings.HasPrefix(upper, "G")) && i == 2:
+			states, err = parseStates(part[1:])
+		default:
+			return nil, fmt.Errorf("invalid rule %q: want B and S parts, and optionally C, got %q", s, part)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule %q: %v", s, err)
+		}
+	}
+	name := "B" + nameB + "/S" + nameS
+	if states > 2 {
+		name += "/C" + strconv.Itoa(states)
+	}
+	r := newRule(name+shape.String(), shape, func(n Neighborhood) bool {
+		count, letter := classify(n)
+		if n.C().IsAlive() {
+			return survival[count][letter]
+		}
+		return birth[count][letter]
+	})
+	r.states = states
+	if states > 2 && r.alive[0] {
+		return nil, fmt.Errorf("invalid rule %q: the Generations rules cannot give birth to cells with no living neighbours", s)
+	}
+	return r, nil
+}
+
+// parseShape splits the rulestring into the rule and the shape of its neighborhood, given with a suffix.
+func parseShape(s string) (string, Shape, error) {
+	if i := strings.LastIndex(strings.ToUpper(s), "N@"); i != -1 {
+		shape, err := ParseShape(s[i+2:])
+		return s[:i], shape, err
+	}
+	switch {
+	case strings.HasSuffix(strings.ToUpper(s), "H"):
+		return s[:len(s)-1], Hex, nil
+	case strings.HasSuffix(strings.ToUpper(s), "V"):
+		return s[:len(s)-1], VonNeumann, nil
+	}
+	return s, Moore, nil
+}
+
+// numeric returns true iff none of the parts of a rule starts with a letter, as in the S/B/C notation of Golly.
+func numeric(parts []string) bool {
+	for _, part := range parts {
+		if part != "" && (part[0] < '0' || part[0] > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseStates parses the number of states of a Generations rule.
+func parseStates(s string) (int, error) {
+	states, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number of states %q", s)
+	}
+	if states < 2 || states > state.MaxStates {
+		return 0, fmt.Errorf("the number of states must be between 2 and %d, got %d", state.MaxStates, states)
+	}
+	return states, nil
+}
+
+func mustParseRule(s string) *Rule {
+	r, err := ParseRule(s)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// String returns the name of the rule.
+func (r *Rule) String() string {
+	return r.name
+}
+
+// Shape returns the shape of the neighborhood of the rule.
+func (r *Rule) Shape() Shape {
+	return r.shape
+}
+
+// Sides returns the sides of the neighborhood of the rule, including C.
+//
+// These are all the sides, see Sides, but for the rules of other shapes, e.g.
+// VonNeumann. The ancestors of the cells only have living cells at these
+// sides.
+func (r *Rule) Sides() []Side {
+	return r.shape.Sides()
+}
+
+// NeighbourOffsets returns the offsets of the neighbours of the rule, see Side.Offset.
+//
+// These are the Sides of the rule but C. The slice is shared by all the
+// callers, so it must not be modified.
+func (r *Rule) NeighbourOffsets() [][2]int {
+	return r.offsets
+}
+
+// States returns the number of states of the rule, 2 unless it is a Generations rule.
+func (r *Rule) States() int {
+	return r.states
+}
+
+// Next returns the state a cell with the given neighborhood evolves into.
+//
+// Under a Generations rule it is only the state the living and the dead cells
+// evolve into, if they do not die. See Evolve.
+func (r *Rule) Next(n Neighborhood) state.State {
+	return state.Of(r.alive[n&0x1ff])
+}
+
+// Evolve returns the state a cell of the state s evolves into, given the neighborhood of the living cells around it.
+func (r *Rule) Evolve(s state.State, n Neighborhood) state.State {
+	switch {
+	case s.IsDying():
+		if int(s)+1 < r.states {
+			return s + 1
+		}
+		return state.Dead
+	case r.alive[n&0x1ff]:
+		return state.Alive
+	case s.IsAlive() && r.states > 2:
+		return 2
+	}
+	return state.Dead
+}
+
+// Parent returns the state of the parent of a cell of the state s, given the neighborhood of the living cells of the parent around it.
+//
+// The neighborhood must be one of the Ancestors of s. The living cells of the
+// parent tell everything but its dying cells: a cell in a dying state came
+// from the previous one, and a dead cell which would have been born came from
+// the last one. A dead cell which would not have been born might have come
+// from either the last dying state or a dead cell, and Parent picks the latter.
+func (r *Rule) Parent(s state.State, n Neighborhood) state.State {
+	switch {
+	case s > 2:
+		return s - 1
+	case s == state.Dead && r.states > 2 && r.alive[n&0x1ff]:
+		return state.State(r.states - 1)
+	}
+	return n.C()
+}
+
+// Totalistic returns the numbers of living neighbours giving birth and letting a cell survive, and false if the rule depends on more than these numbers.
+//
+// The numbers are the bits of the masks: bit k of birth is set iff a dead
+// cell with k living neighbours is born. The neighbours are the ones of the
+// Shape of the rule. The rules in the B/S notation are totalistic unless they
+// have the Hensel letters, and so may be the rules given as tables.
+func (r *Rule) Totalistic() (birth, survival uint16, ok bool) {
+	return r.birth, r.survival, r.totalistic
+}
+
+// countTotals implements Totalistic, going through all the neighborhoods.
+func (r *Rule) countTotals() (birth, survival uint16, ok bool) {
+	// decided holds the numbers seen so far, for the dead and the living cell.
+	var decided [2]uint16
+	for n := Neighborhood(0); n < 0x200; n++ {
+		count, _ := r.shape.count(n)
+		bit := uint16(1) << uint(count)
+		masks, c := &birth, 0
+		if n.C().IsAlive() {
+			masks, c = &survival, 1
+		}
+		if decided[c]&bit != 0 && (*masks&bit != 0) != r.alive[n] {
+			return 0, 0, false
+		}
+		decided[c] |= bit
+		if r.alive[n] {
+			*masks |= bit
+		}
+	}
+	return birth, survival, true
+}
+
+// AncestorsOfAlive returns a new instance of a set representing all ancestors of a living cell.
+func (r *Rule) AncestorsOfAlive() *Set {
+	return r.ancestorsOfAlive.Copy()
+}
+
+// AncestorsOfDead returns a new instance of a set representing all ancestors of a dead cell.
+func (r *Rule) AncestorsOfDead() *Set {
+	return r.ancestorsOfDead.Copy()
+}
+
+// Ancestors returns a new instance of a set representing all ancestors of a cell of the given state.
+//
+// The ancestors are the neighborhoods of the living cells of the parent, with
+// the cells outside of the neighborhood of the rule dead, see Sides. Under
+// a Generations rule a dead cell may come from the last dying state, and a
+// dying one from the previous state, so the living neighbours do not matter
+// as long as the cell itself was not alive. The set is empty for the states
+// the rule does not have.
+func (r *Rule) Ancestors(s state.State) *Set {
+	switch {
+	case r.states == 2 && s.IsAlive():
+		return r.AncestorsOfAlive()
+	case r.states == 2 && s == state.Dead:
+		return r.AncestorsOfDead()
+	}
+	rv := &Set{}
+	for n := Neighborhood(0); n < 0x200; n++ {
+		var ok bool
+		switch {
+		case int(s) >= r.states || !r.shape.Contains(n):
+		case s.IsAlive():
+			ok = r.alive[n]
+		case s == 2:
+			ok = n.C().IsAlive() && !r.alive[n]
+		default:
+			ok = !n.C().IsAlive()
+		}
+		if ok {
+			rv.Add(n)
+		}
+	}
+	return rv
+}
+
+// NextBackground returns the state that the background of the given state evolves into.
+//
+// The background is made of all the cells beyond the edges of a grid, see
+// grid.Plane. Under the rules with B0 it does not stay dead: without S8 it
+// strobes, alive every other generation, and with S8 it stays alive.
+func (r *Rule) NextBackground(s state.State) state.State {
+	var n Neighborhood
+	if s.IsAlive() {
+		n = Neighborhood(r.shape)
+	}
+	return r.Evolve(s, n)
+}
+
+// PreviousBackground returns the state of the background evolving into the background of the given state.
+//
+// Of the two possible states, the one that stays the same is preferred, so
+// that the background is dead whenever it can be. It returns an error if
+// neither evolves into s.
+func (r *Rule) PreviousBackground(s state.State) (state.State, error) {
+	other := state.Alive
+	if s.IsAlive() {
+		other = state.Dead
+	}
+	for _, prev := range []state.State{s, other} {
+		if r.NextBackground(prev) == s {
+			return prev, nil
+		}
+	}
+	return 0, fmt.Errorf("no background evolves into %s under the %s rule", s.ToStr(), r)
+}
+
+// Relative returns the rule the cells follow relative to the backgrounds, given the background of the parents.
+//
+// A cell is alive relative to the background iff its state differs from the
+// state of the background. So the backgrounds are always dead in these terms,
+// and a Relative rule never gives birth to cells with no living neighbours,
+// even if the rule itself does. For a rule with B0 and without S8 the two
+// Relative rules take turns: the one of the dead background evolves the
+// even generations, and the one of the living background the odd ones. The
+// rule itself is returned if the background stays dead.
+//
+// Only the rules with two states have Relative rules of a living background.
+func (r *Rule) Relative(background state.State) *Rule {
+	r = r.Base()
+	next := r.NextBackground(background)
+	if !background.IsAlive() && !next.IsAlive() {
+		return r
+	}
+	r.relativeOnce[background].Do(func() {
+		var flip Neighborhood
+		if background.IsAlive() {
+			flip = Neighborhood(r.shape)
+		}
+		rv := newRule(fmt.Sprintf("%s relative to the %s background", r.name, strings.ToLower(background.ToStr())), r.shape, func(n Neighborhood) bool {
+			return r.alive[n^flip] != next.IsAlive()
+		})
+		rv.base = r
+		rv.background = background
+		r.relative[background] = rv
+	})
+	return r.relative[background]
+}
+
+// Base returns the rule that the Relative rule is derived from, or the rule itself for the other rules.
+func (r *Rule) Base() *Rule {
+	if r.base != nil {
+		return r.base
+	}
+	return r
+}
+
+// ParentBackground returns the background of the parents evolved by the Relative rule, or Dead for the other rules.
+func (r *Rule) ParentBackground() state.State {
+	return r.background
+}
+
+// Previous returns the Relative rule evolving the parents of the cells evolved by this one.
+//
+// It is the rule itself unless the background changes, e.g. for a rule with
+// B0 and without S8, where the two Relative rules take turns.
+func (r *Rule) Previous() (*Rule, error) {
+	background, err := r.Base().PreviousBackground(r.background)
+	if err != nil {
+		return nil, err
+	}
+	return r.Base().Relative(background), nil
+}
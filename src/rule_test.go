@@ -0,0 +1,411 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package neighborhood
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pawelz/efilfoemag/src/state"
+)
+
+func TestParseRule(t *testing.T) {
+	for _, td := range []struct {
+		input string
+		name  string
+		// alive is the number of the ancestors of a living cell.
+		alive int
+		// dead is the number of the ancestors of a dead cell, if not all
+		// the others.
+		dead int
+	}{
+		{input: "B3/S23", name: "B3/S23", alive: 140},
+		{input: "b3/s23", name: "B3/S23", alive: 140},
+		{input: "S32/B3", name: "B3/S23", alive: 140},
+		// HighLife: 6 of 8 neighbours add (8 6) = 28 births.
+		{input: "B36/S23", name: "B36/S23", alive: 168},
+		// Seeds: nothing survives.
+		{input: "B2/S", name: "B2/S", alive: 28},
+		// Day & Night is symmetric under swapping the states.
+		{input: "B3678/S34678", name: "B3678/S34678", alive: 256},
+		{input: "B/S012345678", name: "B/S012345678", alive: 256},
+		// 2a has 8 arrangements, out of (8 2) = 28.
+		{input: "B2-a/S12", name: "B2-a/S12", alive: 28 - 8 + 8 + 28},
+		{input: "b2ka/s1c", name: "B2ak/S1c", alive: 8 + 8 + 4},
+		{input: "B3cekainyqjr/S2-cekain3", name: "B3ceaiknjqry/S2-ceaikn3", alive: 56 + 56},
+		// The S/B/C notation of Golly.
+		{input: "23/3", name: "B3/S23", alive: 140},
+		{input: "23/3/2", name: "B3/S23", alive: 140},
+		// Brian's Brain.
+		{input: "/2/3", name: "B2/S/C3", alive: 28},
+		{input: "b2/s/g3", name: "B2/S/C3", alive: 28},
+		// Star Wars.
+		{input: "345/2/4", name: "B2/S345/C4", alive: 28 + 56 + 70 + 56},
+		// The hexagonal neighborhoods have 2^7 arrangements of 6 neighbours.
+		{input: "B2/S34H", name: "B2/S34H", alive: 15 + 20 + 15, dead: 0x80 - 50},
+		{input: "s43/b2h", name: "B2/S34H", alive: 15 + 20 + 15, dead: 0x80 - 50},
+		{input: "34/2H", name: "B2/S34H", alive: 15 + 20 + 15, dead: 0x80 - 50},
+		{input: "/2/3H", name: "B2/S/C3H", alive: 15, dead: 0x80 - 15},
+		// The von Neumann neighborhoods have 2^5 arrangements of 4 neighbours.
+		{input: "B2/S013V", name: "B2/S013V", alive: 6 + 1 + 4 + 4, dead: 0x20 - 15},
+		{input: "B2/S013N@0ba", name: "B2/S013V", alive: 6 + 1 + 4 + 4, dead: 0x20 - 15},
+		{input: "B3/S23N@1ff", name: "B3/S23", alive: 140},
+		{input: "B1/S1N@0a0", name: "B1/S1N@0b0", alive: 2 + 2, dead: 0x8 - 4},
+	} {
+		t.Run(td.input, func(t *testing.T) {
+			r, err := ParseRule(td.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if r.String() != td.name {
+				t.Errorf("expected name %q, got %q", td.name, r.String())
+			}
+			if got := r.AncestorsOfAlive().Size(); got != td.alive {
+				t.Errorf("expected %d ancestors of living, got %d", td.alive, got)
+			}
+			dead := td.dead
+			if dead == 0 {
+				dead = 0x200 - td.alive
+			}
+			if got := r.AncestorsOfDead().Size(); got != dead {
+				t.Errorf("expected %d ancestors of dead, got %d", dead, got)
+			}
+		})
+	}
+
+	for _, input := range []string{"", "B3", "B3/S23/S4", "B3/B23", "B9/S23", "B33/S23", "X3/S23", "B3/S2x", "B2-/S", "B0c/S", "B2aa/S", "B1c1e/S", "B3t/S", "B2/S/C1", "B2/S/C29", "B2/S/C", "B2/S/X3", "C3/B2/S", "/2/x", "/2/3/4", "B7/S34H", "B2a/S34H", "B22/SH", "B5/S013V", "B2e/S0V", "B1/S1N@", "B1/S1N@xyz", "B1/S1N@200", "B3/S1N@0a0", "B02/S/C3", "1/02/3"} {
+		t.Run(input, func(t *testing.T) {
+			if r, err := ParseRule(input); err == nil {
+				t.Errorf("expected an error, got %v", r)
+			}
+		})
+	}
+}
+
+func TestRuleNext(t *testing.T) {
+	for _, td := range []struct {
+		rule     *Rule
+		n        string
+		expected state.State
+	}{
+		{rule: Conway, n: "+#+#+#+++", expected: state.Alive},
+		{rule: Conway, n: "+#+###+++", expected: state.Alive},
+		{rule: Conway, n: "+#+#+++++", expected: state.Dead},
+		{rule: Conway, n: "########+", expected: state.Dead},
+		{rule: mustParseRule("B36/S23"), n: "###+#+##+", expected: state.Dead},
+		{rule: mustParseRule("B36/S23"), n: "###+++###", expected: state.Alive},
+	} {
+		t.Run(td.rule.String()+"/"+td.n, func(t *testing.T) {
+			n, err := Parse(td.n)
+			if err != nil {
+				t.Fatalf("cannot parse testdata: %v", err)
+			}
+			if got := td.rule.Next(n); got != td.expected {
+				t.Errorf("expected %v, got %v", td.expected, got)
+			}
+		})
+	}
+}
+
+func TestRuleEvolve(t *testing.T) {
+	brian := mustParseRule("/2/3")
+	starWars := mustParseRule("345/2/4")
+	for _, td := range []struct {
+		rule     *Rule
+		s        state.State
+		n        string
+		expected state.State
+	}{
+		{rule: Conway, s: state.Alive, n: "+#+###+++", expected: state.Alive},
+		{rule: Conway, s: state.Alive, n: "########+", expected: state.Dead},
+		{rule: brian, s: state.Dead, n: "+#+#+++++", expected: state.Alive},
+		{rule: brian, s: state.Dead, n: "+#+++++++", expected: state.Dead},
+		{rule: brian, s: state.Alive, n: "+#+##++++", expected: 2},
+		{rule: brian, s: 2, n: "+#+#+++++", expected: state.Dead},
+		{rule: starWars, s: state.Alive, n: "+#+###+++", expected: state.Alive},
+		{rule: starWars, s: state.Alive, n: "+++##++++", expected: 2},
+		{rule: starWars, s: 2, n: "+#+#+++++", expected: 3},
+		{rule: starWars, s: 3, n: "+#+#+++++", expected: state.Dead},
+	} {
+		t.Run(fmt.Sprintf("%s/%d/%s", td.rule, td.s, td.n), func(t *testing.T) {
+			n, err := Parse(td.n)
+			if err != nil {
+				t.Fatalf("cannot parse testdata: %v", err)
+			}
+			got := td.rule.Evolve(td.s, n)
+			if got != td.expected {
+				t.Fatalf("expected %v, got %v", td.expected, got)
+			}
+			if ok, _ := td.rule.Ancestors(got).Contains(n); !ok {
+				t.Errorf("expected %s among the ancestors of %v", td.n, got)
+			}
+			if p := td.rule.Parent(got, n); td.rule.Evolve(p, n) != got {
+				t.Errorf("expected a parent evolving into %v, got %v", got, p)
+			}
+		})
+	}
+}
+
+func TestRuleBackground(t *testing.T) {
+	for _, td := range []struct {
+		rule string
+		// next holds the backgrounds that Dead and Alive evolve into.
+		next [2]state.State
+		// previous holds the backgrounds evolving into Dead and Alive, or
+		// MaxStates if there is none.
+		previous [2]state.State
+	}{
+		{rule: "B3/S23", next: [2]state.State{state.Dead, state.Dead}, previous: [2]state.State{state.Dead, state.MaxStates}},
+		{rule: "B3/S238", next: [2]state.State{state.Dead, state.Alive}, previous: [2]state.State{state.Dead, state.Alive}},
+		{rule: "B013/S012", next: [2]state.State{state.Alive, state.Dead}, previous: [2]state.State{state.Alive, state.Dead}},
+		{rule: "B0/S8", next: [2]state.State{state.Alive, state.Alive}, previous: [2]state.State{state.MaxStates, state.Alive}},
+		{rule: "B0/S2V", next: [2]state.State{state.Alive, state.Dead}, previous: [2]state.State{state.Alive, state.Dead}},
+		{rule: "B3/S23/C3", next: [2]state.State{state.Dead, 2}, previous: [2]state.State{state.Dead, state.MaxStates}},
+	} {
+		t.Run(td.rule, func(t *testing.T) {
+			r := mustParseRule(td.rule)
+			for _, s := range []state.State{state.Dead, state.Alive} {
+				if got := r.NextBackground(s); got != td.next[s] {
+					t.Errorf("NextBackground(%s): expected %s, got %s", s.ToStr(), td.next[s].ToStr(), got.ToStr())
+				}
+				got, err := r.PreviousBackground(s)
+				if td.previous[s] == state.MaxStates {
+					if err == nil {
+						t.Errorf("PreviousBackground(%s): expected an error, got %s", s.ToStr(), got.ToStr())
+					}
+					continue
+				}
+				if err != nil || got != td.previous[s] {
+					t.Errorf("PreviousBackground(%s): expected %s, got %s, %v", s.ToStr(), td.previous[s].ToStr(), got.ToStr(), err)
+				}
+				if r.States() > 2 && got.IsAlive() {
+					continue
+				}
+				relative := r.Relative(got)
+				if relative.Base() != r || relative.ParentBackground() != got {
+					t.Errorf("Relative(%s): expected a rule derived from %s, got %s", got.ToStr(), r, relative)
+				}
+				if relative.Next(0).IsAlive() {
+					t.Errorf("Relative(%s): expected no birth with no living neighbours", got.ToStr())
+				}
+				// Every cell evolves the same relative to the backgrounds.
+				for n := Neighborhood(0); n < 0x200; n++ {
+					if !r.Shape().Contains(n) {
+						continue
+					}
+					abs := n
+					if got.IsAlive() {
+						abs ^= Neighborhood(r.Shape())
+					}
+					want := r.Next(abs).IsAlive() != td.next[got].IsAlive()
+					if relative.Next(n).IsAlive() != want {
+						t.Fatalf("Relative(%s): %s evolves differently", got.ToStr(), n.ToStr())
+					}
+				}
+				previous, err := relative.Previous()
+				if err != nil {
+					t.Fatalf("Relative(%s).Previous: %v", got.ToStr(), err)
+				}
+				if want, _ := r.PreviousBackground(got); previous.ParentBackground() != want {
+					t.Errorf("Relative(%s).Previous: expected the parents on %s, got %s", got.ToStr(), want.ToStr(), previous.ParentBackground().ToStr())
+				}
+			}
+		})
+	}
+}
+
+func TestRuleRelativeConcurrent(t *testing.T) {
+	r := mustParseRule("B0/S2V")
+	got := make(chan *Rule)
+	for i := 0; i < 8; i++ {
+		go func() {
+			got <- r.Relative(state.Alive)
+		}()
+	}
+	want := <-got
+	for i := 1; i < 8; i++ {
+		if rv := <-got; rv != want {
+			t.Errorf("Relative(Alive) returned both %s and %s", want, rv)
+		}
+	}
+}
+
+func TestRuleTotalistic(t *testing.T) {
+	for _, td := range []struct {
+		rule     string
+		birth    uint16
+		survival uint16
+		ok       bool
+	}{
+		{rule: "B3/S23", birth: 0x008, survival: 0x00c, ok: true},
+		{rule: "B36/S23", birth: 0x048, survival: 0x00c, ok: true},
+		{rule: "B0/S8", birth: 0x001, survival: 0x100, ok: true},
+		{rule: "B2/S34H", birth: 0x004, survival: 0x018, ok: true},
+		{rule: "B2/S013V", birth: 0x004, survival: 0x00b, ok: true},
+		{rule: "B2/S/C3", birth: 0x004, ok: true},
+		{rule: "B2-a/S12"},
+		{rule: "B3/S2a3"},
+	} {
+		t.Run(td.rule, func(t *testing.T) {
+			birth, survival, ok := mustParseRule(td.rule).Totalistic()
+			if ok != td.ok || birth != td.birth || survival != td.survival {
+				t.Errorf("expected %#x, %#x, %v, got %#x, %#x, %v", td.birth, td.survival, td.ok, birth, survival, ok)
+			}
+		})
+	}
+}
+
+func TestRuleNeighbourOffsets(t *testing.T) {
+	for _, td := range []struct {
+		rule string
+		want [][2]int
+	}{
+		{rule: "B3/S23", want: [][2]int{{-1, -1}, {0, -1}, {1, -1}, {-1, 0}, {1, 0}, {-1, 1}, {0, 1}, {1, 1}}},
+		{rule: "B2/S013V", want: [][2]int{{0, -1}, {-1, 0}, {1, 0}, {0, 1}}},
+	} {
+		if got := mustParseRule(td.rule).NeighbourOffsets(); fmt.Sprint(got) != fmt.Sprint(td.want) {
+			t.Errorf("%s: want %v, got %v", td.rule, td.want, got)
+		}
+	}
+}
+
+func TestRuleAncestors(t *testing.T) {
+	for _, td := range []struct {
+		rule string
+		// sizes are the numbers of ancestors of every state, and one more.
+		sizes []int
+	}{
+		{rule: "B3/S23", sizes: []int{372, 140, 0}},
+		{rule: "/2/3", sizes: []int{256, 28, 256, 0}},
+		{rule: "345/2/4", sizes: []int{256, 210, 256 - 182, 256, 0}},
+	} {
+		t.Run(td.rule, func(t *testing.T) {
+			r := mustParseRule(td.rule)
+			for s, size := range td.sizes {
+				if got := r.Ancestors(state.State(s)).Size(); got != size {
+					t.Errorf("expected %d ancestors of %d, got %d", size, s, got)
+				}
+			}
+		})
+	}
+}
+
+func TestHenselLetter(t *testing.T) {
+	// sizes is the number of arrangements of every letter.
+	sizes := map[string]int{}
+	for n := Neighborhood(0); n < 0x200; n++ {
+		count, letter := HenselLetter(n)
+		if count == 0 || count == 8 {
+			if letter != 0 {
+				t.Errorf("%s: expected no letter, got %c", n.ToStr(), letter)
+			}
+			continue
+		}
+		if strings.IndexByte(henselLetters[count], letter) == -1 {
+			t.Errorf("%s: expected one of %q, got %q", n.ToStr(), henselLetters[count], letter)
+			continue
+		}
+		for _, m := range []Neighborhood{n.Transpose(), n.mirror(), n ^ 1<<uint(C)} {
+			if c, l := HenselLetter(m); c != count || l != letter {
+				t.Errorf("%s is %d%c, but %s is %d%c", n.ToStr(), count, letter, m.ToStr(), c, l)
+			}
+		}
+		if n.C().IsAlive() {
+			sizes[fmt.Sprintf("%d%c", count, letter)]++
+		}
+	}
+	for count, letters := range henselLetters {
+		var total int
+		for i := 0; i < len(letters); i++ {
+			size := sizes[fmt.Sprintf("%d%c", count, letters[i])]
+			if size == 0 {
+				t.Errorf("%d%c: expected some arrangements, got none", count, letters[i])
+			}
+			total += size
+		}
+		// The binomial coefficients (8 count).
+		if want := []int{1, 8, 28, 56, 70, 56, 28, 8, 1}[count]; count > 0 && count < 8 && total != want {
+			t.Errorf("%d: expected %d arrangements, got %d", count, want, total)
+		}
+	}
+	for _, class := range henselClasses {
+		n, err := Parse(class.n)
+		if err != nil {
+			t.Fatalf("cannot parse testdata: %v", err)
+		}
+		if count, letter := HenselLetter(n); count != class.count || letter != class.letter {
+			t.Errorf("%s: expected %d%c, got %d%c", class.n, class.count, class.letter, count, letter)
+		}
+	}
+}
+
+func TestHenselLetterReference(t *testing.T) {
+	// The arrangements of the letters as defined by Golly, listed clockwise
+	// from N. The arrangements of 5 to 7 neighbours are the complements of
+	// the ones of 3 to 1.
+	for _, td := range []struct {
+		name  string
+		sides []Side
+	}{
+		{name: "1c", sides: []Side{NE}},
+		{name: "1e", sides: []Side{N}},
+		{name: "2c", sides: []Side{NE, SE}},
+		{name: "2e", sides: []Side{N, E}},
+		{name: "2a", sides: []Side{N, NE}},
+		{name: "2i", sides: []Side{N, S}},
+		{name: "2k", sides: []Side{N, SE}},
+		{name: "2n", sides: []Side{NE, SW}},
+		{name: "3c", sides: []Side{NE, SE, SW}},
+		{name: "3e", sides: []Side{N, E, S}},
+		{name: "3a", sides: []Side{N, NE, E}},
+		{name: "3i", sides: []Side{N, NE, NW}},
+		{name: "3k", sides: []Side{N, E, SW}},
+		{name: "3n", sides: []Side{N, NE, SE}},
+		{name: "3j", sides: []Side{N, NE, W}},
+		{name: "3q", sides: []Side{N, NE, SW}},
+		{name: "3r", sides: []Side{N, NE, S}},
+		{name: "3y", sides: []Side{N, SE, SW}},
+		{name: "4c", sides: []Side{NE, SE, SW, NW}},
+		{name: "4e", sides: []Side{N, E, S, W}},
+		{name: "4a", sides: []Side{N, NE, E, SE}},
+		{name: "4i", sides: []Side{N, NE, SE, S}},
+		{name: "4k", sides: []Side{N, NE, SE, W}},
+		{name: "4n", sides: []Side{N, NE, SE, NW}},
+		{name: "4j", sides: []Side{N, NE, S, W}},
+		{name: "4q", sides: []Side{N, NE, E, SW}},
+		{name: "4r", sides: []Side{N, NE, E, S}},
+		{name: "4y", sides: []Side{N, NE, SE, SW}},
+		{name: "4t", sides: []Side{N, NE, S, NW}},
+		{name: "4w", sides: []Side{N, NE, SW, W}},
+		{name: "4z", sides: []Side{N, NE, S, SW}},
+	} {
+		var n Neighborhood
+		for _, s := range td.sides {
+			n |= 1 << uint(s)
+		}
+		arrangements := map[string]Neighborhood{td.name: n}
+		if len(td.sides) < 4 {
+			arrangements[fmt.Sprintf("%d%c", 8-len(td.sides), td.name[1])] = n ^ 0x1ef
+		}
+		for name, n := range arrangements {
+			for _, m := range []Neighborhood{n, n | 1<<uint(C)} {
+				if count, letter := HenselLetter(m); fmt.Sprintf("%d%c", count, letter) != name {
+					t.Errorf("%s: expected %s, got %d%c", m.ToStr(), name, count, letter)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,668 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sat
+
+import (
+	"fmt"
+	"sort"
+)
+
+// lit is a literal. Variable v (counting from 0) is 2v, its negation is 2v+1.
+type lit int
+
+func mkLit(dimacs int) lit {
+	if dimacs < 0 {
+		return lit(2*(-dimacs-1) + 1)
+	}
+	return lit(2 * (dimacs - 1))
+}
+
+func (l lit) neg() lit {
+	return l ^ 1
+}
+
+func (l lit) v() int {
+	return int(l >> 1)
+}
+
+func (l lit) dimacs() int {
+	if l&1 != 0 {
+		return -l.v() - 1
+	}
+	return l.v() + 1
+}
+
+// lbool is a truth value, which may be undefined.
+type lbool int8
+
+const (
+	undef lbool = iota
+	isTrue
+	isFalse
+)
+
+// watcher is an entry of the watch list of a literal.
+//
+// The blocker is some other literal of the clause. If it is true, the clause is
+// satisfied and does not have to be visited at all.
+type watcher struct {
+	c       *clause
+	blocker lit
+}
+
+type clause struct {
+	lits     []lit
+	learnt   bool
+	deleted  bool
+	activity float64
+	lbd      int
+}
+
+const (
+	varDecay      = 0.95
+	clauseDecay   = 0.999
+	restartUnit   = 100
+	firstReduceDB = 2000
+	incReduceDB   = 300
+)
+
+// Solver is a conflict-driven clause-learning SAT solver.
+//
+// It follows the design of MiniSat: two watched literals per clause, VSIDS
+// variable activities, phase saving, Luby restarts and periodic deletion of
+// the learnt clauses that did not prove useful.
+type Solver struct {
+	clauses []*clause
+	learnts []*clause
+	watches [][]watcher
+
+	// values is indexed by literals, so both v and -v have their entries.
+	values   []lbool
+	level    []int
+	reason   []*clause
+	polarity []bool
+	trail    []lit
+	trailLim []int
+	qhead    int
+
+	activity []float64
+	varInc   float64
+	claInc   float64
+	order    *varHeap
+
+	seen  []bool
+	model []bool
+
+	// assumptions are decided first, in the order given to SolveAssuming.
+	assumptions []lit
+	core        []int
+
+	ok        bool
+	conflicts int
+	// nextReduce is the number of conflicts at which the learnt clauses are
+	// reduced next. It is kept across the calls to Solve, as conflicts is.
+	nextReduce int
+}
+
+// New returns a solver for a formula over variables 1..numVars.
+func New(numVars int) *Solver {
+	s := &Solver{
+		watches:  make([][]watcher, 2*numVars),
+		values:   make([]lbool, 2*numVars),
+		level:    make([]int, numVars),
+		reason:   make([]*clause, numVars),
+		polarity: make([]bool, numVars),
+		activity: make([]float64, numVars),
+		seen:     make([]bool, numVars),
+		varInc:   1,
+		claInc:   1,
+		ok:       true,
+
+		nextReduce: firstReduceDB,
+	}
+	s.order = &varHeap{activity: s.activity, index: make([]int, numVars)}
+	for v := 0; v < numVars; v++ {
+		s.order.index[v] = -1
+		s.order.push(v)
+	}
+	return s
+}
+
+// NumVars returns the number of variables of the solver.
+func (s *Solver) NumVars() int {
+	return len(s.values) / 2
+}
+
+func (s *Solver) value(l lit) lbool {
+	return s.values[l]
+}
+
+func (s *Solver) decisionLevel() int {
+	return len(s.trailLim)
+}
+
+// AddClause adds a clause made of DIMACS literals.
+//
+// It returns false if the formula has become trivially unsatisfiable.
+func (s *Solver) AddClause(dimacs []int) (bool, error) {
+	if !s.ok {
+		return false, nil
+	}
+	var lits []lit
+	present := map[lit]bool{}
+	for _, d := range dimacs {
+		if d == 0 || d > s.NumVars() || -d > s.NumVars() {
+			return false, fmt.Errorf("literal %d is out of range (1-%d)", d, s.NumVars())
+		}
+		l := mkLit(d)
+		switch {
+		case present[l.neg()] || s.value(l) == isTrue:
+			return true, nil
+		case present[l] || s.value(l) == isFalse:
+			continue
+		}
+		present[l] = true
+		lits = append(lits, l)
+	}
+	switch len(lits) {
+	case 0:
+		s.ok = false
+	case 1:
+		s.enqueue(lits[0], nil)
+		s.ok = s.propagate() == nil
+	default:
+		c := &clause{lits: lits}
+		s.clauses = append(s.clauses, c)
+		s.attach(c)
+	}
+	return s.ok, nil
+}
+
+func (s *Solver) attach(c *clause) {
+	s.watches[c.lits[0]] = append(s.watches[c.lits[0]], watcher{c: c, blocker: c.lits[1]})
+	s.watches[c.lits[1]] = append(s.watches[c.lits[1]], watcher{c: c, blocker: c.lits[0]})
+}
+
+func (s *Solver) enqueue(l lit, from *clause) {
+	v := l.v()
+	s.values[l] = isTrue
+	s.values[l.neg()] = isFalse
+	s.level[v] = s.decisionLevel()
+	s.reason[v] = from
+	s.trail = append(s.trail, l)
+}
+
+// propagate performs unit propagation and returns the conflicting clause, if any.
+func (s *Solver) propagate() *clause {
+	for s.qhead < len(s.trail) {
+		falseLit := s.trail[s.qhead].neg()
+		s.qhead++
+		ws := s.watches[falseLit]
+		j := 0
+		for i := 0; i < len(ws); i++ {
+			w := ws[i]
+			if s.values[w.blocker] == isTrue {
+				ws[j] = w
+				j++
+				continue
+			}
+			c := w.c
+			if c.deleted {
+				continue
+			}
+			if c.lits[0] == falseLit {
+				c.lits[0], c.lits[1] = c.lits[1], c.lits[0]
+			}
+			if s.values[c.lits[0]] == isTrue {
+				ws[j] = watcher{c: c, blocker: c.lits[0]}
+				j++
+				continue
+			}
+			moved := false
+			for k := 2; k < len(c.lits); k++ {
+				if s.values[c.lits[k]] != isFalse {
+					c.lits[1], c.lits[k] = c.lits[k], c.lits[1]
+					s.watches[c.lits[1]] = append(s.watches[c.lits[1]], watcher{c: c, blocker: c.lits[0]})
+					moved = true
+					break
+				}
+			}
+			if moved {
+				continue
+			}
+			ws[j] = watcher{c: c, blocker: c.lits[0]}
+			j++
+			if s.values[c.lits[0]] == isFalse {
+				j += copy(ws[j:], ws[i+1:])
+				s.watches[falseLit] = ws[:j]
+				s.qhead = len(s.trail)
+				return c
+			}
+			s.enqueue(c.lits[0], c)
+		}
+		s.watches[falseLit] = ws[:j]
+	}
+	return nil
+}
+
+func (s *Solver) bumpVar(v int) {
+	s.activity[v] += s.varInc
+	if s.activity[v] > 1e100 {
+		for i := range s.activity {
+			s.activity[i] *= 1e-100
+		}
+		s.varInc *= 1e-100
+	}
+	s.order.update(v)
+}
+
+func (s *Solver) bumpClause(c *clause) {
+	c.activity += s.claInc
+	if c.activity > 1e20 {
+		for _, l := range s.learnts {
+			l.activity *= 1e-20
+		}
+		s.claInc *= 1e-20
+	}
+}
+
+// analyze derives the first-UIP learnt clause from the conflict.
+//
+// The asserting literal is the first one of the clause, and the literal with
+// the highest decision level among the others is the second one. It also
+// returns the level to backjump to.
+func (s *Solver) analyze(confl *clause) ([]lit, int) {
+	learnt := []lit{0}
+	pathC := 0
+	p := lit(-1)
+	idx := len(s.trail) - 1
+	for {
+		if confl.learnt {
+			s.bumpClause(confl)
+		}
+		start := 0
+		if p != -1 {
+			start = 1
+		}
+		for _, q := range confl.lits[start:] {
+			v := q.v()
+			if s.seen[v] || s.level[v] == 0 {
+				continue
+			}
+			s.bumpVar(v)
+			s.seen[v] = true
+			if s.level[v] >= s.decisionLevel() {
+				pathC++
+			} else {
+				learnt = append(learnt, q)
+			}
+		}
+		for !s.seen[s.trail[idx].v()] {
+			idx--
+		}
+		p = s.trail[idx]
+		idx--
+		confl = s.reason[p.v()]
+		s.seen[p.v()] = false
+		pathC--
+		if pathC == 0 {
+			break
+		}
+	}
+	learnt[0] = p.neg()
+
+	// Drop the literals implied by the other literals of the clause.
+	minimized := []lit{learnt[0]}
+	for _, q := range learnt[1:] {
+		r := s.reason[q.v()]
+		redundant := r != nil
+		if redundant {
+			for _, o := range r.lits[1:] {
+				if !s.seen[o.v()] && s.level[o.v()] > 0 {
+					redundant = false
+					break
+				}
+			}
+		}
+		if !redundant {
+			minimized = append(minimized, q)
+		}
+	}
+	for _, q := range learnt {
+		s.seen[q.v()] = false
+	}
+	learnt = minimized
+
+	btLevel := 0
+	if len(learnt) > 1 {
+		maxI := 1
+		for i := 2; i < len(learnt); i++ {
+			if s.level[learnt[i].v()] > s.level[learnt[maxI].v()] {
+				maxI = i
+			}
+		}
+		learnt[1], learnt[maxI] = learnt[maxI], learnt[1]
+		btLevel = s.level[learnt[1].v()]
+	}
+	return learnt, btLevel
+}
+
+func (s *Solver) lbd(lits []lit) int {
+	levels := map[int]bool{}
+	for _, l := range lits {
+		levels[s.level[l.v()]] = true
+	}
+	return len(levels)
+}
+
+func (s *Solver) cancelUntil(level int) {
+	if s.decisionLevel() <= level {
+		return
+	}
+	for i := len(s.trail) - 1; i >= s.trailLim[level]; i-- {
+		v := s.trail[i].v()
+		s.polarity[v] = s.values[2*v] == isTrue
+		s.values[2*v] = undef
+		s.values[2*v+1] = undef
+		s.reason[v] = nil
+		s.order.push(v)
+	}
+	s.trail = s.trail[:s.trailLim[level]]
+	s.trailLim = s.trailLim[:level]
+	s.qhead = len(s.trail)
+}
+
+func (s *Solver) locked(c *clause) bool {
+	v := c.lits[0].v()
+	return s.reason[v] == c && s.value(c.lits[0]) == isTrue
+}
+
+// reduceDB deletes about half of the learnt clauses, keeping the most useful ones.
+func (s *Solver) reduceDB() {
+	sort.Slice(s.learnts, func(i, j int) bool {
+		a, b := s.learnts[i], s.learnts[j]
+		if a.lbd != b.lbd {
+			return a.lbd > b.lbd
+		}
+		return a.activity < b.activity
+	})
+	kept := s.learnts[:0]
+	limit := len(s.learnts) / 2
+	for i, c := range s.learnts {
+		if i < limit && c.lbd > 2 && len(c.lits) > 2 && !s.locked(c) {
+			c.deleted = true
+			continue
+		}
+		kept = append(kept, c)
+	}
+	s.learnts = kept
+	for l, ws := range s.watches {
+		j := 0
+		for _, w := range ws {
+			if !w.c.deleted {
+				ws[j] = w
+				j++
+			}
+		}
+		s.watches[l] = ws[:j]
+	}
+}
+
+// luby returns the i-th element (counting from 0) of the Luby sequence 1, 1, 2, 1, 1, 2, 4, ...
+func luby(i int) int {
+	size, seq := 1, 0
+	for size < i+1 {
+		seq++
+		size = 2*size + 1
+	}
+	for size-1 != i {
+		size = (size - 1) / 2
+		seq--
+		i = i % size
+	}
+	return 1 << uint(seq)
+}
+
+// search runs the CDCL loop until a model or a proof is found, or the conflict budget runs out.
+func (s *Solver) search(budget int) lbool {
+	for conflicts := 0; ; {
+		if confl := s.propagate(); confl != nil {
+			s.conflicts++
+			conflicts++
+			if s.decisionLevel() == 0 {
+				s.ok = false
+				return isFalse
+			}
+			learnt, btLevel := s.analyze(confl)
+			s.cancelUntil(btLevel)
+			if len(learnt) == 1 {
+				s.enqueue(learnt[0], nil)
+			} else {
+				c := &clause{lits: learnt, learnt: true, lbd: s.lbd(learnt)}
+				s.learnts = append(s.learnts, c)
+				s.attach(c)
+				s.bumpClause(c)
+				s.enqueue(learnt[0], c)
+			}
+			s.varInc /= varDecay
+			s.claInc /= clauseDecay
+			continue
+		}
+		if conflicts >= budget {
+			s.cancelUntil(0)
+			return undef
+		}
+		if s.conflicts >= s.nextReduce {
+			s.nextReduce += firstReduceDB + incReduceDB*(s.nextReduce/firstReduceDB)
+			s.reduceDB()
+		}
+		next := lit(-1)
+		for s.decisionLevel() < len(s.assumptions) {
+			p := s.assumptions[s.decisionLevel()]
+			if s.values[p] == isTrue {
+				// The level is kept empty, so that the levels match the assumptions.
+				s.trailLim = append(s.trailLim, len(s.trail))
+			} else if s.values[p] == isFalse {
+				s.analyzeFinal(p.neg())
+				return isFalse
+			} else {
+				next = p
+				break
+			}
+		}
+		for next == -1 && s.order.len() > 0 {
+			if v := s.order.pop(); s.values[2*v] == undef {
+				next = lit(2*v + 1)
+				if s.polarity[v] {
+					next = lit(2 * v)
+				}
+			}
+		}
+		if next == -1 {
+			return isTrue
+		}
+		s.trailLim = append(s.trailLim, len(s.trail))
+		s.enqueue(next, nil)
+	}
+}
+
+// analyzeFinal finds the assumptions that imply p, whose negation is one of the assumptions.
+//
+// They are stored in core, together with the negation of p.
+func (s *Solver) analyzeFinal(p lit) {
+	s.core = []int{p.neg().dimacs()}
+	if s.level[p.v()] == 0 {
+		return
+	}
+	s.seen[p.v()] = true
+	for i := len(s.trail) - 1; i >= s.trailLim[0]; i-- {
+		v := s.trail[i].v()
+		if !s.seen[v] {
+			continue
+		}
+		if r := s.reason[v]; r == nil {
+			// All the decisions made so far are assumptions.
+			s.core = append(s.core, s.trail[i].dimacs())
+		} else {
+			for _, q := range r.lits[1:] {
+				if s.level[q.v()] > 0 {
+					s.seen[q.v()] = true
+				}
+			}
+		}
+		s.seen[v] = false
+	}
+}
+
+// Solve returns true iff the formula is satisfiable.
+//
+// The model can be read with Value afterwards. More clauses may be added
+// after Solve returns, and Solve may be called again.
+func (s *Solver) Solve() bool {
+	ok, _ := s.SolveAssuming(nil)
+	return ok
+}
+
+// SolveAssuming returns true iff the formula is satisfiable with all the given literals true.
+//
+// The assumptions only hold for this call. If it returns false, Core tells
+// which of the assumptions are to blame.
+func (s *Solver) SolveAssuming(assumptions []int) (bool, error) {
+	s.assumptions = s.assumptions[:0]
+	s.core = nil
+	for _, d := range assumptions {
+		if d == 0 || d > s.NumVars() || -d > s.NumVars() {
+			return false, fmt.Errorf("literal %d is out of range (1-%d)", d, s.NumVars())
+		}
+		s.assumptions = append(s.assumptions, mkLit(d))
+	}
+	return s.solve(), nil
+}
+
+// Core returns the assumptions that made the last call to SolveAssuming fail.
+//
+// The formula is unsatisfiable with these assumptions alone. The core is empty
+// if the formula is unsatisfiable with no assumptions at all.
+func (s *Solver) Core() []int {
+	return s.core
+}
+
+func (s *Solver) solve() bool {
+	if !s.ok {
+		return false
+	}
+	for restart := 0; ; restart++ {
+		switch s.search(luby(restart) * restartUnit) {
+		case isTrue:
+			s.model = make([]bool, s.NumVars())
+			for v := range s.model {
+				s.model[v] = s.values[2*v] == isTrue
+			}
+			s.cancelUntil(0)
+			return true
+		case isFalse:
+			s.cancelUntil(0)
+			return false
+		}
+	}
+}
+
+// Value returns the value of the variable (counting from 1) in the model found by Solve.
+func (s *Solver) Value(v int) bool {
+	return s.model[v-1]
+}
+
+// Conflicts returns the number of conflicts encountered so far.
+func (s *Solver) Conflicts() int {
+	return s.conflicts
+}
+
+// varHeap is a max-heap of variables ordered by activity.
+type varHeap struct {
+	activity []float64
+	heap     []int
+	// index[v] is the position of v in heap, or -1 if v is not in the heap.
+	index []int
+}
+
+func (h *varHeap) len() int {
+	return len(h.heap)
+}
+
+func (h *varHeap) less(i, j int) bool {
+	return h.activity[h.heap[i]] > h.activity[h.heap[j]]
+}
+
+func (h *varHeap) swap(i, j int) {
+	h.heap[i], h.heap[j] = h.heap[j], h.heap[i]
+	h.index[h.heap[i]] = i
+	h.index[h.heap[j]] = j
+}
+
+func (h *varHeap) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !h.less(i, parent) {
+			break
+		}
+		h.swap(i, parent)
+		i = parent
+	}
+}
+
+func (h *varHeap) down(i int) {
+	for {
+		child := 2*i + 1
+		if child >= len(h.heap) {
+			break
+		}
+		if child+1 < len(h.heap) && h.less(child+1, child) {
+			child++
+		}
+		if !h.less(child, i) {
+			break
+		}
+		h.swap(i, child)
+		i = child
+	}
+}
+
+func (h *varHeap) push(v int) {
+	if h.index[v] >= 0 {
+		return
+	}
+	h.heap = append(h.heap, v)
+	h.index[v] = len(h.heap) - 1
+	h.up(len(h.heap) - 1)
+}
+
+func (h *varHeap) pop() int {
+	v := h.heap[0]
+	last := len(h.heap) - 1
+	h.swap(0, last)
+	h.heap = h.heap[:last]
+	h.index[v] = -1
+	if last > 0 {
+		h.down(0)
+	}
+	return v
+}
+
+// update restores the heap order after the activity of v has grown.
+func (h *varHeap) update(v int) {
+	if h.index[v] >= 0 {
+		h.up(h.index[v])
+	}
+}
@@ -0,0 +1,276 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sat
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// pigeonhole returns the clauses stating that n+1 pigeons sit in n holes, each in a different one.
+func pigeonhole(n int) (int, [][]int) {
+	v := func(p, h int) int {
+		return p*n + h + 1
+	}
+	var clauses [][]int
+	for p := 0; p <= n; p++ {
+		var c []int
+		for h := 0; h < n; h++ {
+			c = append(c, v(p, h))
+		}
+		clauses = append(clauses, c)
+	}
+	for h := 0; h < n; h++ {
+		for p := 0; p <= n; p++ {
+			for q := p + 1; q <= n; q++ {
+				clauses = append(clauses, []int{-v(p, h), -v(q, h)})
+			}
+		}
+	}
+	return (n + 1) * n, clauses
+}
+
+// bruteForce returns true iff the formula is satisfiable, checking all assignments.
+func bruteForce(numVars int, clauses [][]int) bool {
+	for a := 0; a < 1<<uint(numVars); a++ {
+		if satisfied(clauses, func(v int) bool { return a&(1<<uint(v-1)) != 0 }) {
+			return true
+		}
+	}
+	return false
+}
+
+func satisfied(clauses [][]int, value func(int) bool) bool {
+	for _, c := range clauses {
+		var sat bool
+		for _, l := range c {
+			if l > 0 && value(l) || l < 0 && !value(-l) {
+				sat = true
+				break
+			}
+		}
+		if !sat {
+			return false
+		}
+	}
+	return true
+}
+
+func solve(t *testing.T, numVars int, clauses [][]int) (*Solver, bool) {
+	t.Helper()
+	s := New(numVars)
+	for _, c := range clauses {
+		if _, err := s.AddClause(c); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	return s, s.Solve()
+}
+
+func TestSolve(t *testing.T) {
+	for _, td := range []struct {
+		name    string
+		numVars int
+		clauses [][]int
+		want    bool
+	}{
+		{name: "empty", numVars: 1, want: true},
+		{name: "unit", numVars: 1, clauses: [][]int{{1}}, want: true},
+		{name: "contradicting units", numVars: 1, clauses: [][]int{{1}, {-1}}, want: false},
+		{name: "empty clause", numVars: 1, clauses: [][]int{{}}, want: false},
+		{name: "tautology", numVars: 2, clauses: [][]int{{1, -1}, {2}}, want: true},
+		{
+			name:    "implication chain",
+			numVars: 4,
+			clauses: [][]int{{1}, {-1, 2}, {-2, 3}, {-3, 4}, {-4, -1, 3}},
+			want:    true,
+		},
+		{
+			name:    "xor",
+			numVars: 2,
+			clauses: [][]int{{1, 2}, {-1, -2}, {1, -2}, {-1, 2}},
+			want:    false,
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			s, got := solve(t, td.numVars, td.clauses)
+			if got != td.want {
+				t.Fatalf("want %v, got %v", td.want, got)
+			}
+			if got && !satisfied(td.clauses, s.Value) {
+				t.Errorf("the model does not satisfy the formula")
+			}
+		})
+	}
+}
+
+func TestPigeonhole(t *testing.T) {
+	for n := 1; n <= 6; n++ {
+		t.Run(fmt.Sprintf("%d holes", n), func(t *testing.T) {
+			numVars, clauses := pigeonhole(n)
+			if _, got := solve(t, numVars, clauses); got {
+				t.Errorf("want unsatisfiable, got satisfiable")
+			}
+		})
+	}
+}
+
+func TestRandom3SAT(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	const numVars = 12
+	for i := 0; i < 300; i++ {
+		var clauses [][]int
+		// 4.26 clauses per variable is where random 3-SAT gets hard.
+		for j := 0; j < 51; j++ {
+			var c []int
+			for k := 0; k < 3; k++ {
+				l := r.Intn(numVars) + 1
+				if r.Intn(2) == 0 {
+					l = -l
+				}
+				c = append(c, l)
+			}
+			clauses = append(clauses, c)
+		}
+		s, got := solve(t, numVars, clauses)
+		if want := bruteForce(numVars, clauses); got != want {
+			t.Fatalf("formula %v: want %v, got %v", clauses, want, got)
+		}
+		if got && !satisfied(clauses, s.Value) {
+			t.Fatalf("formula %v: the model does not satisfy the formula", clauses)
+		}
+	}
+}
+
+func TestIncremental(t *testing.T) {
+	// Enumerate all the models of x1 | x2 | x3 by blocking the ones found.
+	s := New(3)
+	s.AddClause([]int{1, 2, 3})
+	var models int
+	for s.Solve() {
+		models++
+		var block []int
+		for v := 1; v <= 3; v++ {
+			if s.Value(v) {
+				block = append(block, -v)
+			} else {
+				block = append(block, v)
+			}
+		}
+		s.AddClause(block)
+	}
+	if models != 7 {
+		t.Errorf("want 7 models, got %d", models)
+	}
+}
+
+func TestReduceAcrossCalls(t *testing.T) {
+	// The pigeonhole clauses only hold if the selector is assumed true, so
+	// the solver can be called again and again after refuting them.
+	numVars, clauses := pigeonhole(7)
+	selector := numVars + 1
+	s := New(selector)
+	for _, c := range clauses {
+		if _, err := s.AddClause(append(c, -selector)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if ok, err := s.SolveAssuming([]int{selector}); ok || err != nil {
+		t.Fatalf("want unsatisfiable, got %v, %v", ok, err)
+	}
+	if s.Conflicts() <= firstReduceDB {
+		t.Fatalf("want more than %d conflicts, got %d", firstReduceDB, s.Conflicts())
+	}
+	learnts := len(s.learnts)
+	for i := 0; i < 10; i++ {
+		if ok, err := s.SolveAssuming([]int{-selector}); !ok || err != nil {
+			t.Fatalf("want satisfiable, got %v, %v", ok, err)
+		}
+	}
+	if len(s.learnts) < learnts/2 {
+		t.Errorf("want at least %d of the %d learnt clauses kept, got %d", learnts/2, learnts, len(s.learnts))
+	}
+}
+
+func TestSolveAssuming(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	const numVars = 12
+	for i := 0; i < 200; i++ {
+		var clauses [][]int
+		// Fewer clauses than in TestRandom3SAT, so that most formulas are
+		// satisfiable and the assumptions make the difference.
+		for j := 0; j < 30; j++ {
+			var c []int
+			for k := 0; k < 3; k++ {
+				l := r.Intn(numVars) + 1
+				if r.Intn(2) == 0 {
+					l = -l
+				}
+				c = append(c, l)
+			}
+			clauses = append(clauses, c)
+		}
+		s, _ := solve(t, numVars, clauses)
+		// Every call uses the same solver, with different assumptions.
+		for j := 0; j < 5; j++ {
+			var assumptions [][]int
+			for _, v := range r.Perm(numVars)[:4] {
+				if r.Intn(2) == 0 {
+					v = -v - 1
+				} else {
+					v = v + 1
+				}
+				assumptions = append(assumptions, []int{v})
+			}
+			var flat []int
+			for _, a := range assumptions {
+				flat = append(flat, a[0])
+			}
+			got, err := s.SolveAssuming(flat)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if want := bruteForce(numVars, append(append([][]int{}, clauses...), assumptions...)); got != want {
+				t.Fatalf("formula %v, assumptions %v: want %v, got %v", clauses, flat, want, got)
+			}
+			if got {
+				if !satisfied(append(append([][]int{}, clauses...), assumptions...), s.Value) {
+					t.Fatalf("formula %v, assumptions %v: the model does not satisfy the formula", clauses, flat)
+				}
+				continue
+			}
+			core := append([][]int{}, clauses...)
+			for _, l := range s.Core() {
+				core = append(core, []int{l})
+			}
+			if bruteForce(numVars, core) {
+				t.Fatalf("formula %v, assumptions %v: the core %v is satisfiable", clauses, flat, s.Core())
+			}
+		}
+	}
+	if _, err := New(2).SolveAssuming([]int{3}); err == nil {
+		t.Errorf("expected a failure for a literal out of range")
+	}
+}
+
+func TestLuby(t *testing.T) {
+	want := []int{1, 1, 2, 1, 1, 2, 4, 1, 1, 2, 1, 1, 2, 4, 8, 1}
+	for i, w := range want {
+		if got := luby(i); got != w {
+			t.Errorf("luby(%d): want %d, got %d", i, w, got)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package neighborhood
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Shape is the set of the cells of the neighborhood a rule looks at.
+//
+// It is a mask of the sides, the bit of every side set as in Neighborhood,
+// and it always includes C. The cells outside of the shape are ignored: they
+// are always dead in the ancestors, and they are not compared when matching
+// neighborhoods.
+type Shape uint16
+
+const (
+	// Moore is the whole 3x3 neighborhood. This is the default.
+	Moore Shape = 0x1ff
+	// VonNeumann is the neighborhood of the orthogonal neighbours only.
+	VonNeumann Shape = 1<<uint(N) | 1<<uint(W) | 1<<uint(C) | 1<<uint(E) | 1<<uint(S)
+	// Hex is the hexagonal neighborhood, see HexSides.
+	Hex Shape = Moore &^ (1<<uint(NE) | 1<<uint(SW))
+)
+
+var (
+	// overlapsByShape caches the overlaps of the shapes, for every distance
+	// (1 and 2) and side. It is guarded by overlapsMu, as the rules may be
+	// built and used concurrently.
+	overlapsByShape = map[Shape]*[3][9]*Overlap{}
+	overlapsMu      sync.Mutex
+)
+
+// ShapeOf returns the shape made of the given sides and C.
+func ShapeOf(sides ...Side) Shape {
+	rv := Shape(1 << uint(C))
+	for _, s := range sides {
+		rv |= 1 << uint(s)
+	}
+	return rv
+}
+
+// ParseShape parses a shape given as the hexadecimal mask of its sides, e.g. "0ba" for VonNeumann.
+//
+// C is added to the shape if the mask lacks it.
+func ParseShape(mask string) (Shape, error) {
+	m, err := strconv.ParseUint(mask, 16, 16)
+	if err != nil || m > uint64(Moore) {
+		return 0, fmt.Errorf("invalid shape %q: want a hexadecimal mask of at most 1ff", mask)
+	}
+	return Shape(m) | 1<<uint(C), nil
+}
+
+// Sides returns all sides of the shape, including C, in the reading order.
+func (s Shape) Sides() []Side {
+	var rv []Side
+	for _, side := range sides {
+		if s&(1<<uint(side)) != 0 {
+			rv = append(rv, side)
+		}
+	}
+	return rv
+}
+
+// Contains returns true iff all the living cells of the neighborhood are within the shape.
+func (s Shape) Contains(n Neighborhood) bool {
+	return uint16(n)&^uint16(s) == 0
+}
+
+// Size returns the number of the neighbours in the shape, without C.
+func (s Shape) Size() int {
+	count, _ := s.count(Neighborhood(s))
+	return count
+}
+
+// count returns the number of the living neighbours of the center of the neighborhood within the shape.
+//
+// It has the signature of HenselLetter, with no letters.
+func (s Shape) count(n Neighborhood) (int, byte) {
+	var count int
+	for _, side := range sides {
+		if side != C && s&(1<<uint(side)) != 0 && n&(1<<uint(side)) != 0 {
+			count++
+		}
+	}
+	return count, 0
+}
+
+// String returns the suffix of the rulestrings of the shape: none for Moore, "V" for VonNeumann, "H" for Hex, and "N@" followed by the mask of the other shapes.
+func (s Shape) String() string {
+	switch s {
+	case Moore:
+		return ""
+	case VonNeumann:
+		return "V"
+	case Hex:
+		return "H"
+	}
+	return fmt.Sprintf("N@%03x", uint16(s))
+}
+
+// overlaps returns the overlaps of the neighborhoods of the shape, for every distance (1 and 2) and side.
+//
+// Two neighborhoods share the cells that are within the shape in both of
+// them, so the overlaps follow from the shape alone.
+func (s Shape) overlaps() *[3][9]*Overlap {
+	overlapsMu.Lock()
+	defer overlapsMu.Unlock()
+	if o, ok := overlapsByShape[s]; ok {
+		return o
+	}
+	var rv [3][9]*Overlap
+	for _, dist := range []int{1, 2} {
+		for _, side := range sides {
+			if side == C {
+				continue
+			}
+			ox, oy := side.Offset()
+			ox, oy = ox*dist, oy*dist
+			var shared []SidePair
+			for _, p := range s.Sides() {
+				px, py := p.Offset()
+				qx, qy := px-ox, py-oy
+				if qx < -1 || qx > 1 || qy < -1 || qy > 1 || s&(1<<uint(4-qx-3*qy)) == 0 {
+					continue
+				}
+				shared = append(shared, SidePair{Left: p, Right: Side(4 - qx - 3*qy)})
+			}
+			rv[dist][side] = NewOverlap(shared)
+		}
+	}
+	overlapsByShape[s] = &rv
+	return &rv
+}
+
+// overlap returns the overlap of the neighborhoods of the shape at given distance and side, see Matches.
+func (s Shape) overlap(dist int, side Side) (*Overlap, error) {
+	if side == C {
+		return nil, fmt.Errorf("C is not a valid side for matching neighborhoods")
+	}
+	if dist != 1 && dist != 2 {
+		return nil, fmt.Errorf("want dist equal 1 or 2, got %d", dist)
+	}
+	return s.overlaps()[dist][side], nil
+}
+
+// Matches checks whether the neighborhood k matches n at given distance and side, comparing only the cells within the shape.
+//
+// See Neighborhood.Matches for the meaning of dist and side.
+func (s Shape) Matches(n, k Neighborhood, dist int, side Side) (bool, error) {
+	o, err := s.overlap(dist, side)
+	if err != nil {
+		return false, err
+	}
+	return o.keyN[n&0x1ff] == o.keyK[k&0x1ff], nil
+}
+
+// ShiftIntersect performs the "shift & intersect" operation on sets of neighborhoods of the shape.
+//
+// This is ShiftIntersectAt with the matching of Shape.Matches.
+func (s Shape) ShiftIntersect(left *Set, right *Set, dist int, side Side) (*Set, *Set, error) {
+	o, err := s.overlap(dist, side)
+	if err != nil {
+		return nil, nil, err
+	}
+	return IntersectOverlap(left, right, o)
+}
+
+// parseCounts parses a part of a totalistic rule of the shape, e.g. "013", without its B or S.
+//
+// It returns the same as parseHensel, with no letters, as only the Moore
+// neighborhood has them.
+func (s Shape) parseCounts(part string) (*[9]map[byte]bool, string, error) {
+	var rv [9]map[byte]bool
+	for i := 0; i < len(part); i++ {
+		d := part[i]
+		if d < '0' || int(d-'0') > s.Size() {
+			return nil, "", fmt.Errorf("%q is not a number of neighbours, want 0-%d", d, s.Size())
+		}
+		if rv[d-'0'] != nil {
+			return nil, "", fmt.Errorf("%q is repeated", d)
+		}
+		rv[d-'0'] = map[byte]bool{0: true}
+	}
+	var canonical strings.Builder
+	for count, letters := range rv {
+		if letters != nil {
+			canonical.WriteByte(byte('0' + count))
+		}
+	}
+	return &rv, canonical.String(), nil
+}
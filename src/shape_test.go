@@ -0,0 +1,135 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package neighborhood
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestShape(t *testing.T) {
+	for _, td := range []struct {
+		mask  string
+		shape Shape
+		sides []Side
+		name  string
+	}{
+		{mask: "1ff", shape: Moore, sides: []Side{NW, N, NE, W, C, E, SW, S, SE}, name: ""},
+		{mask: "0ba", shape: VonNeumann, sides: []Side{N, W, C, E, S}, name: "V"},
+		{mask: "aa", shape: VonNeumann, sides: []Side{N, W, C, E, S}, name: "V"},
+		{mask: "1bb", shape: Hex, sides: []Side{NW, N, W, C, E, S, SE}, name: "H"},
+		{mask: "0A0", shape: ShapeOf(N, W), sides: []Side{N, W, C}, name: "N@0b0"},
+		{mask: "0", shape: ShapeOf(), sides: []Side{C}, name: "N@010"},
+	} {
+		t.Run(td.mask, func(t *testing.T) {
+			shape, err := ParseShape(td.mask)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if shape != td.shape {
+				t.Errorf("expected %03x, got %03x", td.shape, shape)
+			}
+			if got := fmt.Sprint(shape.Sides()); got != fmt.Sprint(td.sides) {
+				t.Errorf("expected sides %v, got %v", td.sides, got)
+			}
+			if shape.Size() != len(td.sides)-1 {
+				t.Errorf("expected %d neighbours, got %d", len(td.sides)-1, shape.Size())
+			}
+			if shape.String() != td.name {
+				t.Errorf("expected name %q, got %q", td.name, shape.String())
+			}
+		})
+	}
+	for _, mask := range []string{"", "200", "x", "-1"} {
+		if shape, err := ParseShape(mask); err == nil {
+			t.Errorf("%q: expected an error, got %v", mask, shape)
+		}
+	}
+}
+
+func TestShapeMatches(t *testing.T) {
+	for _, td := range []struct {
+		shape        Shape
+		n            string
+		k            string
+		matchesDist1 []Side
+		matchesDist2 []Side
+	}{
+		{
+			// Only the orthogonal cells are compared.
+			shape:        VonNeumann,
+			n:            "#+#,+#+,#+#",
+			k:            "+++,+#+,+++",
+			matchesDist1: []Side{NW, NE, SW, SE},
+			matchesDist2: []Side{NW, N, NE, W, E, SW, S, SE},
+		},
+		{
+			shape:        VonNeumann,
+			n:            "+#+,###,+++",
+			k:            "+++,+#+,+#+",
+			matchesDist1: []Side{N},
+			matchesDist2: []Side{NW, N, NE, SW, S, SE},
+		},
+		{
+			// Neighborhoods of N and W share no cells at NW and SE.
+			shape:        ShapeOf(N, W),
+			n:            "+#+,##+,+++",
+			k:            "+++,+#+,+++",
+			matchesDist1: []Side{NW, N, W, SE},
+			matchesDist2: []Side{NW, N, NE, W, E, SW, S, SE},
+		},
+	} {
+		for _, dist := range []int{1, 2} {
+			want := map[Side]bool{}
+			for _, side := range map[int][]Side{1: td.matchesDist1, 2: td.matchesDist2}[dist] {
+				want[side] = true
+			}
+			for _, side := range []Side{NW, N, NE, W, E, SW, S, SE} {
+				t.Run(fmt.Sprintf("%s/%s/%s/dist=%d,side=%s", td.shape, td.n, td.k, dist, side.ToStr()), func(t *testing.T) {
+					n, err := Parse(td.n)
+					if err != nil {
+						t.Fatalf("unable to parse testdata n: %v", err)
+					}
+					k, err := Parse(td.k)
+					if err != nil {
+						t.Fatalf("unable to parse testdata k: %v", err)
+					}
+					got, err := td.shape.Matches(n, k, dist, side)
+					if err != nil {
+						t.Fatalf("unexpected error: %v", err)
+					}
+					if got != want[side] {
+						t.Errorf("want %v got %v", want[side], got)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestShapeConcurrent(t *testing.T) {
+	done := make(chan error)
+	for _, side := range []Side{NW, N, NE, W, E, SW, S, SE} {
+		go func(s Shape) {
+			_, err := s.Matches(0, 0, 1, N)
+			done <- err
+		}(ShapeOf(side, N))
+	}
+	for i := 0; i < 8; i++ {
+		if err := <-done; err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package solver
+
+import (
+	"fmt"
+
+	"github.com/pawelz/efilfoemag/src/grid"
+	"github.com/pawelz/efilfoemag/src/neighborhood"
+)
+
+// search is the state of the backtracking search for a parent.
+//
+// Every cell of the target gets a set of candidate neighborhoods in the
+// parent. The search assigns a single neighborhood to every cell, one cell at
+// a time, always picking the cell with the fewest candidates left. Each
+// assignment is followed by propagate, so the search backtracks as soon as any
+// cell runs out of candidates.
+type search struct {
+	domains  *Domains
+	assigned []bool
+	values   []neighborhood.Neighborhood
+}
+
+// newSearch prepares the search over the given candidates.
+func newSearch(d *Domains) *search {
+	return &search{
+		domains:  d,
+		assigned: make([]bool, len(d.sets)),
+		values:   make([]neighborhood.Neighborhood, len(d.sets)),
+	}
+}
+
+// singleton returns a Set containing only the given neighborhood.
+func singleton(n neighborhood.Neighborhood) *neighborhood.Set {
+	rv := &neighborhood.Set{}
+	rv.Add(n)
+	return rv
+}
+
+// assign sets the value of cell i and prunes the candidates of the other cells.
+//
+// It returns false if any cell is left without candidates. The domains it
+// replaces are returned, so that the caller can restore them.
+func (s *search) assign(i int, n neighborhood.Neighborhood) (bool, map[int]*neighborhood.Set, error) {
+	saved := map[int]*neighborhood.Set{i: s.domains.sets[i]}
+	s.assigned[i] = true
+	s.values[i] = n
+	s.domains.sets[i] = singleton(n)
+	ok, err := s.domains.propagate([]int{i}, func(j int, _ *neighborhood.Set) {
+		if _, ok := saved[j]; !ok {
+			saved[j] = s.domains.sets[j]
+		}
+	})
+	return ok, saved, err
+}
+
+// unassign reverts assign.
+func (s *search) unassign(i int, saved map[int]*neighborhood.Set) {
+	for j, d := range saved {
+		s.domains.sets[j] = d
+	}
+	s.assigned[i] = false
+}
+
+// pick returns the unassigned cell with the fewest candidates, or -1 if all cells are assigned.
+func (s *search) pick() int {
+	best, bestSize := -1, 0
+	for i, d := range s.domains.sets {
+		if s.assigned[i] {
+			continue
+		}
+		if size := d.Size(); best == -1 || size < bestSize {
+			best, bestSize = i, size
+		}
+	}
+	return best
+}
+
+// run assigns the remaining cells. It returns true iff all cells got assigned.
+func (s *search) run() (bool, error) {
+	i := s.pick()
+	if i == -1 {
+		return true, nil
+	}
+	for _, n := range s.domains.sets[i].Elements() {
+		ok, saved, err := s.assign(i, n)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			found, err := s.run()
+			if err != nil || found {
+				return found, err
+			}
+		}
+		s.unassign(i, saved)
+	}
+	return false, nil
+}
+
+// parent builds the parent grid of the target out of the assigned neighborhoods.
+func (s *search) parent(target *grid.Grid) (*grid.Grid, error) {
+	w := s.domains.width
+	p := target.Blank()
+	for i, n := range s.values {
+		st, err := target.Get(uint(i%w), uint(i/w))
+		if err != nil {
+			return nil, err
+		}
+		if err := p.Set(uint(i%w), uint(i/w), target.Rule().Parent(st, n)); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Solve searches for a parent of the target.
+//
+// It returns nil and no error iff the target has no parents, i.e. it is a
+// Garden of Eden. Before any branching the candidates are reduced with
+// Propagate, which alone proves many Gardens of Eden.
+func Solve(target *grid.Grid) (*grid.Grid, error) {
+	d, err := NewDomains(target)
+	if err != nil {
+		return nil, err
+	}
+	return solve(target, d)
+}
+
+// SolveSymmetric searches for a parent of the target invariant under the symmetry.
+//
+// It is Solve over NewSymmetricDomains. It returns nil and no error iff the
+// target has no such parents, and an error if the symmetry does not fit the
+// target, see grid.Symmetry.Check.
+func SolveSymmetric(target *grid.Grid, symmetry *grid.Symmetry) (*grid.Grid, error) {
+	d, err := NewSymmetricDomains(target, symmetry)
+	if err != nil {
+		return nil, err
+	}
+	return solve(target, d)
+}
+
+// solve implements Solve and SolveSymmetric, given the initial candidates.
+func solve(target *grid.Grid, d *Domains) (*grid.Grid, error) {
+	ok, err := Propagate(d)
+	if err != nil {
+		return nil, fmt.Errorf("propagation failed: %v", err)
+	}
+	if !ok {
+		return nil, nil
+	}
+	s := newSearch(d)
+	found, err := s.run()
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %v", err)
+	}
+	if !found {
+		return nil, nil
+	}
+	return s.parent(target)
+}
+
+// FillDying sets the dying states of the parent of the target, of which only the living cells are known.
+//
+// The dying states follow from the living cells and the target, see
+// neighborhood.Rule.Parent. Under the rules without dying states the parent
+// is left as it is.
+func FillDying(parent, target *grid.Grid) error {
+	if target.Rule().States() == 2 {
+		return nil
+	}
+	living := parent.Copy()
+	for y := uint(0); y < target.Height(); y++ {
+		for x := uint(0); x < target.Width(); x++ {
+			n, err := living.Neighborhood(x, y)
+			if err != nil {
+				return err
+			}
+			st, err := target.Get(x, y)
+			if err != nil {
+				return err
+			}
+			if err := parent.Set(x, y, target.Rule().Parent(st, n)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Check verifies that the parent evolves into the target in one step.
+//
+// The parent is stepped with the topology and the rule of the target, whatever
+// its own, see grid.Grid.Step. Its background must evolve into the one of
+// the target too.
+func Check(parent, target *grid.Grid) error {
+	if parent.Width() != target.Width() || parent.Height() != target.Height() {
+		return fmt.Errorf("the parent is %dx%d, but the target is %dx%d", parent.Width(), parent.Height(), target.Width(), target.Height())
+	}
+	if got, want := target.Rule().NextBackground(parent.Background()), target.Background(); got != want {
+		return fmt.Errorf("the background evolves into %s, want %s", got.ToStr(), want.ToStr())
+	}
+	parent = parent.Copy()
+	parent.SetTopology(target.Topology())
+	parent.SetRule(target.Rule())
+	next, err := parent.Step()
+	if err != nil {
+		return err
+	}
+	if next.EqualsTo(target) {
+		return nil
+	}
+	for y := uint(0); y < target.Height(); y++ {
+		for x := uint(0); x < target.Width(); x++ {
+			got, _ := next.Get(x, y)
+			if want, _ := target.Get(x, y); got != want {
+				return fmt.Errorf("cell (%d, %d) evolves into %s, want %s", x, y, got.ToStr(), want.ToStr())
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,585 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package solver
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pawelz/efilfoemag/src/grid"
+	"github.com/pawelz/efilfoemag/src/neighborhood"
+)
+
+func parseGrid(input string, t *testing.T) *grid.Grid {
+	t.Helper()
+	g, err := grid.Parse([]byte(input))
+	if err != nil {
+		t.Fatalf("cannot parse testdata: %v", err)
+	}
+	return g
+}
+
+func TestSolve(t *testing.T) {
+	for _, td := range []struct {
+		name   string
+		target string
+		orphan bool
+	}{
+		{
+			name: "blank",
+			target: `8x8
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+`,
+		},
+		{
+			name: "blinker",
+			target: `8x8
+++++++++
+++++++++
+++++++++
+++###+++
+++++++++
+++++++++
+++++++++
+++++++++
+`,
+		},
+		{
+			name: "glider",
+			target: `8x8
+++++++++
++++#++++
+++++#+++
+++###+++
+++++++++
+++++++++
+++++++++
+++++++++
+`,
+		},
+		{
+			name: "wrapping around the edges",
+			target: `8x8
+#++++++#
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+#++++++#
+`,
+		},
+		{
+			name: "wide",
+			target: `24x8
+++++++++++++++++++++++++
+++++++++++++++++++++++++
++++++++++++++++++++#++++
+++###+++++++++++++#+#+++
++++++++++++++++++++#++++
+++++++++++++++++++++++++
+++++++++++++++++++++++++
+++++++++++++++++++++++++
+`,
+		},
+		{
+			name: "all alive",
+			target: `8x8
+########
+########
+########
+########
+########
+########
+########
+########
+`,
+			orphan: true,
+		},
+	} {
+		for _, name := range StrategyNames() {
+			t.Run(fmt.Sprintf("%s/%s", name, td.name), func(t *testing.T) {
+				strategy, err := StrategyByName(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				target := parseGrid(td.target, t)
+				parent, err := strategy.Solve(target)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if td.orphan {
+					if parent != nil {
+						t.Errorf("want no parents, got:\n%s", parent.ToEfil())
+					}
+					return
+				}
+				if parent == nil {
+					t.Fatalf("want a parent, got none")
+				}
+				if err := Check(parent, target); err != nil {
+					t.Errorf("invalid parent:\n%s\n%v", parent.ToEfil(), err)
+				}
+			})
+		}
+	}
+}
+
+func TestTopologies(t *testing.T) {
+	for _, td := range []struct {
+		name string
+		// parent is stepped to get the target, unless orphan.
+		parent string
+		orphan bool
+	}{
+		{
+			name: "glider",
+			parent: `8x8
++#++++++
+++#+++++
+###+++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+`,
+		},
+		{
+			name: "edges",
+			parent: `8x8
+#+##++##
+#++++##+
+#++##+#+
++##+#+++
+++###+##
+++++###+
+++++##++
+#+++##++
+`,
+		},
+		{
+			name: "all alive",
+			parent: `8x8
+########
+########
+########
+########
+########
+########
+########
+########
+`,
+			orphan: true,
+		},
+	} {
+		for _, name := range grid.TopologyNames() {
+			topology, err := grid.TopologyByName(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			target := parseGrid(td.parent, t)
+			target.SetTopology(topology)
+			if !td.orphan {
+				if target, err = target.Step(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var verdicts []bool
+			for _, strategyName := range StrategyNames() {
+				t.Run(fmt.Sprintf("%s/%s/%s", td.name, name, strategyName), func(t *testing.T) {
+					strategy, err := StrategyByName(strategyName)
+					if err != nil {
+						t.Fatal(err)
+					}
+					parent, err := strategy.Solve(target)
+					if strategyName == "rows" && topology == grid.ProjectivePlane {
+						if err == nil {
+							t.Errorf("want an error, got none")
+						}
+						return
+					}
+					if err != nil {
+						t.Fatalf("unexpected error: %v", err)
+					}
+					verdicts = append(verdicts, parent == nil)
+					if parent == nil {
+						if !td.orphan {
+							t.Errorf("want a parent, got none")
+						}
+						return
+					}
+					if parent.Topology() != topology {
+						t.Errorf("got a parent on the %s topology, want %s", parent.Topology(), topology)
+					}
+					if err := Check(parent, target); err != nil {
+						t.Errorf("invalid parent:\n%s\n%v", parent.ToEfil(), err)
+					}
+				})
+			}
+			for _, v := range verdicts {
+				if v != verdicts[0] {
+					t.Errorf("%s/%s: strategies disagree whether the target is an orphan: %v", td.name, name, verdicts)
+				}
+			}
+		}
+	}
+}
+
+func TestRowsLineLength(t *testing.T) {
+	blank := strings.Repeat(strings.Repeat("+", MaxRowsGluedLineLength+1)+"\n", MaxRowsGluedLineLength+2)
+	header := fmt.Sprintf("%dx%d", MaxRowsGluedLineLength+1, MaxRowsGluedLineLength+2)
+	if parent, err := (Rows{}).Solve(parseGrid(header+" torus\n"+blank, t)); err == nil {
+		t.Errorf("torus: expected an error, got:\n%v", parent)
+	}
+	target := parseGrid(header+" plane\n"+blank, t)
+	parent, err := (Rows{}).Solve(target)
+	if err != nil || parent == nil {
+		t.Fatalf("plane: want a parent, got %v, %v", parent, err)
+	}
+	if err := Check(parent, target); err != nil {
+		t.Errorf("plane: invalid parent:\n%s\n%v", parent.ToEfil(), err)
+	}
+}
+
+func TestRules(t *testing.T) {
+	large := `16x8
+#+##++###+##++##
+#++++##+#++++##+
+#++##+#+#++##+#+
++##+#++++##+#+++
+++###+##++###+##
+++++###+++++###+
+++++##++++++##++
+#+++##++#+++##++
+`
+	// small is the top left quarter of large, for the rules whose targets are
+	// slow to solve, when the tests are run with -short.
+	small := `8x4
+#+##++##
+#++++##+
+#++##+#+
++##+#+++
+`
+	// The MAP rule is the majority of N, W and C, which is not isotropic.
+	for _, td := range []struct {
+		name string
+		slow bool
+	}{
+		{name: "B36/S23", slow: true},
+		{name: "B2/S"},
+		{name: "B3678/S34678", slow: true},
+		{name: "B2-a/S12"},
+		{name: "B2/S34H"},
+		{name: "B2/S013V", slow: true},
+		{name: "B1/S1N@0a0"},
+		{name: "MAPAAAAAAAA//8AAAAAAAD//wAA////////AAD///////8AAAAAAAD//wAAAAAAAP//AAD///////8AAP///////w"},
+	} {
+		name := td.name
+		parent := large
+		if td.slow && testing.Short() {
+			parent = small
+		}
+		rule, err := neighborhood.ParseRule(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		target := parseGrid(parent, t)
+		target.SetRule(rule)
+		if target, err = target.Step(); err != nil {
+			t.Fatal(err)
+		}
+		for _, strategyName := range StrategyNames() {
+			t.Run(fmt.Sprintf("%s/%s", name, strategyName), func(t *testing.T) {
+				strategy, err := StrategyByName(strategyName)
+				if err != nil {
+					t.Fatal(err)
+				}
+				parent, err := strategy.Solve(target)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if parent == nil {
+					t.Fatalf("want a parent, got none")
+				}
+				if parent.Rule() != rule {
+					t.Errorf("got a parent following %s, want %s", parent.Rule(), rule)
+				}
+				if err := Check(parent, target); err != nil {
+					t.Errorf("invalid parent:\n%s\n%v", parent.ToEfil(), err)
+				}
+			})
+		}
+	}
+}
+
+func TestOddSizes(t *testing.T) {
+	for _, parent := range []string{
+		"1x1\n#\n",
+		"5x5\n+#+##\n##+++\n+#+#+\n#+++#\n++##+\n",
+		"7x3 plane\n+##+#+#\n#+##++#\n++#+###\n",
+		"3x11 cylinder\n#+#\n+##\n#++\n+++\n##+\n+#+\n#+#\n+##\n##+\n+++\n#+#\n",
+		"9x6 klein\n#+##+##+#\n+##++#+#+\n##++#+##+\n+++#+#++#\n#+#+++##+\n++##+#+##\n",
+	} {
+		target, err := parseGrid(parent, t).Step()
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := strings.SplitN(parent, "\n", 2)[0]
+		for _, strategyName := range StrategyNames() {
+			t.Run(fmt.Sprintf("%s/%s", name, strategyName), func(t *testing.T) {
+				strategy, err := StrategyByName(strategyName)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := strategy.Solve(target)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if got == nil {
+					t.Fatalf("want a parent, got none")
+				}
+				if err := Check(got, target); err != nil {
+					t.Errorf("invalid parent:\n%s\n%v", got.ToEfil(), err)
+				}
+			})
+		}
+	}
+}
+
+func TestAbsoluteTarget(t *testing.T) {
+	rule, err := neighborhood.ParseRule("B0/S8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := parseGrid("4x4 torus alive\n####\n####\n####\n####\n", t)
+	target.SetRule(rule)
+	for _, name := range StrategyNames() {
+		strategy, err := StrategyByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parent, err := strategy.Solve(target); err == nil {
+			t.Errorf("%s: expected an error, got:\n%v", name, parent)
+		}
+	}
+	if _, err := Count(target); err == nil {
+		t.Errorf("Count: expected an error")
+	}
+	if _, err := Enumerate(target, 0); err == nil {
+		t.Errorf("Enumerate: expected an error")
+	}
+	relative, err := target.Relative()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parent, err := Solve(relative)
+	if err != nil || parent == nil {
+		t.Fatalf("want a parent, got %v, %v", parent, err)
+	}
+	if err := Check(parent.Absolute(relative.Rule().ParentBackground()), target); err != nil {
+		t.Errorf("invalid parent:\n%s\n%v", parent.ToEfil(), err)
+	}
+}
+
+func TestStrobingBackground(t *testing.T) {
+	rule, err := neighborhood.ParseRule("B013/S012")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := parseGrid(`16x8 plane
+#+##++###+##++##
+#++++##+#++++##+
+#++##+#+#++##+#+
++##+#++++##+#+++
+++###+##++###+##
+++++###+++++###+
+++++##++++++##++
+#+++##++#+++##++
+`, t)
+	g.SetRule(rule)
+	if g, err = g.Step(); err != nil {
+		t.Fatal(err)
+	}
+	// The targets are the even generation, on a dead background, and the
+	// odd one, on a living background, so that both have grandparents.
+	for _, name := range []string{"dead", "alive"} {
+		if g, err = g.Step(); err != nil {
+			t.Fatal(err)
+		}
+		target := g
+		relative, err := target.Relative()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, strategyName := range StrategyNames() {
+			t.Run(fmt.Sprintf("%s/%s", name, strategyName), func(t *testing.T) {
+				strategy, err := StrategyByName(strategyName)
+				if err != nil {
+					t.Fatal(err)
+				}
+				parent, err := strategy.Solve(relative)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if parent == nil {
+					t.Fatalf("want a parent, got none")
+				}
+				if err := Check(parent, relative); err != nil {
+					t.Errorf("invalid relative parent:\n%s\n%v", parent.ToEfil(), err)
+				}
+				parent = parent.Absolute(relative.Rule().ParentBackground())
+				if err := Check(parent, target); err != nil {
+					t.Errorf("invalid parent:\n%s\n%v", parent.ToEfil(), err)
+				}
+			})
+		}
+		t.Run(fmt.Sprintf("%s/generations", name), func(t *testing.T) {
+			chain, err := Generations(relative, 2)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(chain) != 3 {
+				t.Fatalf("want 2 generations of ancestors, got %d", len(chain)-1)
+			}
+			r := relative.Rule()
+			chain[2] = target
+			for i := 1; i >= 0; i-- {
+				chain[i] = chain[i].Absolute(r.ParentBackground())
+				if err := Check(chain[i], chain[i+1]); err != nil {
+					t.Errorf("invalid generation %d:\n%s\n%v", i, chain[i].ToEfil(), err)
+				}
+				if r, err = r.Previous(); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestParentSymmetry(t *testing.T) {
+	target := parseGrid(`8x8 plane
+++++++++
++##++##+
++##++##+
+++++++++
+++++++++
++##++##+
++##++##+
+++++++++
+`, t)
+	for _, name := range grid.SymmetryNames() {
+		symmetry, err := grid.SymmetryByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, strategyName := range StrategyNames() {
+			t.Run(fmt.Sprintf("%s/%s", name, strategyName), func(t *testing.T) {
+				strategy, err := StrategyByName(strategyName)
+				if err != nil {
+					t.Fatal(err)
+				}
+				s, ok := strategy.(SymmetricStrategy)
+				if !ok {
+					t.Skipf("the %s strategy does not support symmetries", strategyName)
+				}
+				parent, err := s.SolveSymmetric(target, symmetry)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if parent == nil {
+					t.Fatalf("want a parent, got none")
+				}
+				if err := Check(parent, target); err != nil {
+					t.Errorf("invalid parent:\n%s\n%v", parent.ToEfil(), err)
+				}
+				if err := symmetry.Check(parent); err != nil {
+					t.Errorf("asymmetric parent:\n%s\n%v", parent.ToEfil(), err)
+				}
+			})
+		}
+	}
+	// The glider is not symmetric under C2.
+	glider := parseGrid(`8x8
+++++++++
++++#++++
+++++#+++
+++###+++
+++++++++
+++++++++
+++++++++
+++++++++
+`, t)
+	if _, err := SolveSymmetric(glider, grid.C2); err == nil {
+		t.Errorf("want an error for the asymmetric target")
+	}
+}
+
+func TestGenerationsRules(t *testing.T) {
+	parent := `16x8
+#+##++#A#+##++##
+#++++##+#++++##+
+#++##+#+#++##+#+
++##+#++++##+#+++
+++###+##++###+##
+++++###++B+++###
+++++##++++++##++
+#+++##++#+++##++
+`
+	for _, name := range []string{"/2/3", "345/2/4", "B3/S23/C5", "B24/S35/C3H"} {
+		rule, err := neighborhood.ParseRule(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		target := parseGrid(parent, t)
+		target.SetRule(rule)
+		if target, err = target.Step(); err != nil {
+			t.Fatal(err)
+		}
+		for _, strategyName := range StrategyNames() {
+			t.Run(fmt.Sprintf("%s/%s", name, strategyName), func(t *testing.T) {
+				strategy, err := StrategyByName(strategyName)
+				if err != nil {
+					t.Fatal(err)
+				}
+				parent, err := strategy.Solve(target)
+				if strategyName == "rows" {
+					if err == nil {
+						t.Errorf("expected an error, got %v", parent)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if parent == nil {
+					t.Fatalf("want a parent, got none")
+				}
+				if err := Check(parent, target); err != nil {
+					t.Errorf("invalid parent:\n%s\n%v", parent.ToEfil(), err)
+				}
+			})
+		}
+	}
+}
@@ -14,13 +14,26 @@
 
 package state
 
-type State bool
+import "fmt"
+
+// State is the state of a cell.
+//
+// Life-like rules only have the Dead and Alive states. The rules of the
+// Generations family add the dying states, from 2 up to the number of states
+// of the rule minus one: a living cell which does not survive goes through
+// all of them, in order, before it is dead.
+type State uint8
 
 const (
-	Alive State = true
-	Dead  State = false
+	Dead  State = 0
+	Alive State = 1
 )
 
+// MaxStates is the largest number of states, including Dead and Alive.
+//
+// The dying states are written as the letters 'A' to 'Z'.
+const MaxStates = 28
+
 // Of converts a boolean to the corresponding State.
 func Of(isAlive bool) State {
 	if isAlive {
@@ -29,23 +42,47 @@ func Of(isAlive bool) State {
 	return Dead
 }
 
+// OfRune converts a rune to the corresponding State: '#' -> Alive; '+' -> Dead; 'A' -> 2; 'B' -> 3 and so on.
+func OfRune(r rune) (State, bool) {
+	switch {
+	case r == '#':
+		return Alive, true
+	case r == '+':
+		return Dead, true
+	case r >= 'A' && r <= 'Z':
+		return State(r-'A') + 2, true
+	}
+	return Dead, false
+}
+
 // IsAlive converts a State to the corresponding boolean.
 func (s State) IsAlive() bool {
 	return s == Alive
 }
 
-// ToRune converts a State to its corresponding rune. Alive -> '#'; Dead -> '+'.
+// IsDying returns true iff the State is one of the dying states of the Generations rules.
+func (s State) IsDying() bool {
+	return s > Alive
+}
+
+// ToRune converts a State to its corresponding rune. Alive -> '#'; Dead -> '+'; dying states -> 'A', 'B' and so on.
 func (s State) ToRune() rune {
-	if s.IsAlive() {
+	switch {
+	case s.IsAlive():
 		return '#'
+	case s.IsDying():
+		return 'A' + rune(s-2)
 	}
 	return '+'
 }
 
 // ToStr converts a State to a human readable string.
 func (s State) ToStr() string {
-	if s.IsAlive() {
+	switch {
+	case s.IsAlive():
 		return "Alive"
+	case s.IsDying():
+		return fmt.Sprintf("Dying %d", s)
 	}
 	return "Dead"
 }
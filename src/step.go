@@ -0,0 +1,302 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grid
+
+import (
+	"bytes"
+	"fmt"
+	mathbits "math/bits"
+
+	"github.com/pawelz/efilfoemag/src/neighborhood"
+)
+
+// wordSize is the number of cells packed into every word of a packedRow.
+const wordSize = 64
+
+// packedRow holds the living cells of a row of a grid, extended by one cell on each side.
+//
+// The cell x of the row is the bit x+1, counting from the least significant
+// bit of the first word, so that the bits 0 and width+1 are the cells beyond
+// the left and the right edges.
+type packedRow []uint64
+
+// stepper evolves the grids of a rule, see Step.
+//
+// The totalistic rules, see neighborhood.Rule.Totalistic, are evolved one word
+// of cells at a time. The rows are packed into packedRows, and the numbers of
+// living neighbours of all the cells of a word are added up at once, bit
+// sliced: every bit of the numbers is held in a separate word. The other rules,
+// and the grids with dying cells, are evolved one cell at a time.
+type stepper struct {
+	rule       *neighborhood.Rule
+	totalistic bool
+	// offsets are the offsets of the neighbours counted by the rule.
+	offsets [][2]int
+	// birth and survival hold, for every number of living neighbours, all
+	// ones iff it gives birth to a dead cell, or lets a living cell survive.
+	birth, survival [9]uint64
+}
+
+// newStepper returns the stepper of the rule.
+func newStepper(rule *neighborhood.Rule) *stepper {
+	s := &stepper{rule: rule}
+	birth, survival, ok := rule.Totalistic()
+	if !ok || rule.States() > 2 {
+		return s
+	}
+	s.totalistic = true
+	for k := range s.birth {
+		if birth&(1<<uint(k)) != 0 {
+			s.birth[k] = ^uint64(0)
+		}
+		if survival&(1<<uint(k)) != 0 {
+			s.survival[k] = ^uint64(0)
+		}
+	}
+	s.offsets = rule.NeighbourOffsets()
+	return s
+}
+
+// step returns the next generation of the grid.
+func (s *stepper) step(c *Grid) (*Grid, error) {
+	if !s.totalistic || c.dying != nil {
+		return s.stepCells(c)
+	}
+	return s.stepWords(c), nil
+}
+
+// stepCells returns the next generation of the grid, evolving one cell at a time.
+func (s *stepper) stepCells(c *Grid) (*Grid, error) {
+	next := c.Blank()
+	next.background = s.rule.NextBackground(c.background)
+	for y := uint(0); y < c.height; y++ {
+		for x := uint(0); x < c.width; x++ {
+			n, err := c.Neighborhood(x, y)
+			if err != nil {
+				return nil, fmt.Errorf("cannot Step: %v", err)
+			}
+			st, _ := c.Get(x, y)
+			switch st = s.rule.Evolve(st, n); {
+			case st.IsAlive():
+				next.b[next.byteshift(x, y)] |= bitmask(x)
+			case st.IsDying():
+				next.setDying(x, y, st)
+			}
+		}
+	}
+	return next, nil
+}
+
+// stepWords returns the next generation of the grid, evolving one word of cells at a time.
+func (s *stepper) stepWords(c *Grid) *Grid {
+	next := c.Blank()
+	next.background = s.rule.NextBackground(c.background)
+	// rows holds the rows -1 to height, the ones out of range resolved
+	// with the topology.
+	rows := make([]packedRow, c.height+2)
+	for y := range rows {
+		rows[y] = c.packRow(y - 1)
+	}
+	out := make(packedRow, len(rows[0]))
+	for y := 1; y <= int(c.height); y++ {
+		for w := range out {
+			var count [4]uint64
+			for _, o := range s.offsets {
+				add(&count, rows[y+o[1]].shifted(w, o[0]))
+			}
+			center := rows[y][w]
+			var alive uint64
+			for k := range s.birth {
+				if rule := ^center&s.birth[k] | center&s.survival[k]; rule != 0 {
+					alive |= equals(&count, k) & rule
+				}
+			}
+			out[w] = alive
+		}
+		next.unpackRow(uint(y-1), out)
+	}
+	return next
+}
+
+// add adds the word of single bits to the bit-sliced numbers.
+func add(count *[4]uint64, plane uint64) {
+	for i := range count {
+		count[i], plane = count[i]^plane, count[i]&plane
+	}
+}
+
+// equals returns the word with the bits set where the bit-sliced numbers are k.
+func equals(count *[4]uint64, k int) uint64 {
+	rv := ^uint64(0)
+	for i, bit := range count {
+		if k&(1<<uint(i)) != 0 {
+			rv &= bit
+		} else {
+			rv &^= bit
+		}
+	}
+	return rv
+}
+
+// shifted returns the word w of the row with every cell replaced by the one dx cells to the right of it.
+//
+// dx is -1, 0 or 1.
+func (r packedRow) shifted(w, dx int) uint64 {
+	rv := r[w]
+	switch dx {
+	case -1:
+		rv <<= 1
+		if w > 0 {
+			rv |= r[w-1] >> (wordSize - 1)
+		}
+	case 1:
+		rv >>= 1
+		if w+1 < len(r) {
+			rv |= r[w+1] << (wordSize - 1)
+		}
+	}
+	return rv
+}
+
+// set sets the bit i of the row.
+func (r packedRow) set(i uint) {
+	r[i/wordSize] |= 1 << (i % wordSize)
+}
+
+// packRow returns the row y of the grid, which may be out of range, as a packedRow.
+//
+// The cells out of range are resolved with the topology of the grid, see
+// topologyGet.
+func (c *Grid) packRow(y int) packedRow {
+	rv := make(packedRow, (c.width+2+wordSize-1)/wordSize)
+	if y >= 0 && y < int(c.height) {
+		start := c.byteshift(0, uint(y))
+		for i, octet := range c.b[start : start+c.rowBytes()] {
+			pos := uint(8*i + 1)
+			w, shift := pos/wordSize, pos%wordSize
+			// The bytes hold the leftmost cell in the most significant bit.
+			v := uint64(mathbits.Reverse8(octet))
+			rv[w] |= v << shift
+			// The bits beyond the last word are the padding, which is 0.
+			if shift > wordSize-8 && w+1 < uint(len(rv)) {
+				rv[w+1] |= v >> (wordSize - shift)
+			}
+		}
+	} else {
+		for x := 0; x < int(c.width); x++ {
+			if s, _ := c.topologyGet(x, y); s.IsAlive() {
+				rv.set(uint(x + 1))
+			}
+		}
+	}
+	if s, _ := c.topologyGet(-1, y); s.IsAlive() {
+		rv.set(0)
+	}
+	if s, _ := c.topologyGet(int(c.width), y); s.IsAlive() {
+		rv.set(c.width + 1)
+	}
+	return rv
+}
+
+// unpackRow sets the living cells of the row y of the grid to the ones of the packedRow.
+func (c *Grid) unpackRow(y uint, r packedRow) {
+	start := c.byteshift(0, y)
+	for i := uint(0); i < c.rowBytes(); i++ {
+		pos := 8*i + 1
+		w, shift := pos/wordSize, pos%wordSize
+		v := r[w] >> shift
+		if shift > wordSize-8 && w+1 < uint(len(r)) {
+			v |= r[w+1] << (wordSize - shift)
+		}
+		octet := mathbits.Reverse8(uint8(v))
+		// The bits beyond the width are the padding, which must be 0.
+		if rest := c.width - 8*i; rest < 8 {
+			octet &= 0xff << (8 - rest)
+		}
+		c.b[start+i] = octet
+	}
+}
+
+// Step returns the next generation of the grid, following its rule.
+//
+// The background evolves too, see neighborhood.Rule.NextBackground. Under the
+// totalistic rules the cells are evolved a word of 64 cells at a time.
+func (c *Grid) Step() (*Grid, error) {
+	return newStepper(c.Rule()).step(c)
+}
+
+// StepN returns the generation of the grid n steps later, see Step.
+//
+// The grid itself is copied if n is 0.
+func (c *Grid) StepN(n uint) (*Grid, error) {
+	s := newStepper(c.Rule())
+	rv := c.Copy()
+	for i := uint(0); i < n; i++ {
+		var err error
+		if rv, err = s.step(rv); err != nil {
+			return nil, err
+		}
+	}
+	return rv, nil
+}
+
+// Cycle is the periodic evolution of a grid, see FindCycle.
+type Cycle struct {
+	// Start is the first generation of the cycle, 0 being the grid itself.
+	Start uint
+	// Period is the number of generations after which every generation of
+	// the cycle recurs.
+	Period uint
+}
+
+// FindCycle evolves the grid until a generation repeats an earlier one.
+//
+// The generations are the same if they have the same cells and background.
+// From the first repeated generation on the grid evolves periodically. It
+// returns nil if none of the generations up to maxSteps repeats an earlier
+// one.
+func (c *Grid) FindCycle(maxSteps uint) (*Cycle, error) {
+	s := newStepper(c.Rule())
+	seen := map[string]uint{}
+	g := c
+	for gen := uint(0); ; gen++ {
+		key := g.key()
+		if start, ok := seen[key]; ok {
+			return &Cycle{Start: start, Period: gen - start}, nil
+		}
+		if gen == maxSteps {
+			return nil, nil
+		}
+		seen[key] = gen
+		var err error
+		if g, err = s.step(g); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// key returns a string identifying the cells and the background of the grid.
+func (c *Grid) key() string {
+	var buf bytes.Buffer
+	buf.WriteByte(byte(c.background))
+	buf.Write(c.b)
+	for _, d := range c.dying {
+		if d != 0 {
+			buf.Write(c.dying)
+			break
+		}
+	}
+	return buf.String()
+}
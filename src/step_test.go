@@ -0,0 +1,194 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grid
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/pawelz/efilfoemag/src/neighborhood"
+	"github.com/pawelz/efilfoemag/src/state"
+)
+
+func parseRule(rule string, t *testing.T) *neighborhood.Rule {
+	t.Helper()
+	r, err := neighborhood.ParseRule(rule)
+	if err != nil {
+		t.Fatalf("cannot parse testdata: %v", err)
+	}
+	return r
+}
+
+func TestStepWords(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, rule := range []string{"B3/S23", "B36/S23", "B2/S34H", "B2/S013V", "B013/S012", "B0/S8"} {
+		for _, topology := range topologies {
+			for _, size := range [][2]int{{1, 1}, {3, 1}, {1, 4}, {7, 5}, {63, 3}, {64, 2}, {65, 4}, {130, 3}} {
+				t.Run(fmt.Sprintf("%s/%s/%dx%d", rule, topology, size[0], size[1]), func(t *testing.T) {
+					g, err := New(size[0], size[1])
+					if err != nil {
+						t.Fatal(err)
+					}
+					g.SetTopology(topology)
+					g.SetRule(parseRule(rule, t))
+					for y := uint(0); y < g.Height(); y++ {
+						for x := uint(0); x < g.Width(); x++ {
+							g.Set(x, y, state.Of(r.Intn(2) == 0))
+						}
+					}
+					s := newStepper(g.Rule())
+					if !s.totalistic {
+						t.Fatalf("expected %s to be evolved a word at a time", rule)
+					}
+					// Two steps, so that the background is alive in one
+					// of them under the rules with B0.
+					for i := 0; i < 2; i++ {
+						want, err := s.stepCells(g)
+						if err != nil {
+							t.Fatal(err)
+						}
+						got := s.stepWords(g)
+						if !got.EqualsTo(want) || got.Background() != want.Background() {
+							t.Fatalf("step %d of\n%s\nexpected:\n%s\ngot:\n%s", i, g.ToEfil(), want.ToEfil(), got.ToEfil())
+						}
+						g = want
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestStepN(t *testing.T) {
+	g, err := Parse([]byte(`8x8
+++++++++
++#++++++
+++#+++++
+###+++++
+++++++++
+++++++++
+++++++++
+++++++++
+`))
+	if err != nil {
+		t.Fatalf("cannot parse testdata: %v", err)
+	}
+	for _, td := range []struct {
+		n        uint
+		expected string
+	}{
+		{n: 0, expected: string(g.ToEfil())},
+		{n: 4, expected: `8x8
+++++++++
+++++++++
+++#+++++
++++#++++
++###++++
+++++++++
+++++++++
+++++++++
+`},
+		// The glider crosses the torus diagonally in 4 steps per cell.
+		{n: 32, expected: string(g.ToEfil())},
+	} {
+		t.Run(fmt.Sprint(td.n), func(t *testing.T) {
+			got, err := g.StepN(td.n)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got.ToEfil()) != td.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", td.expected, got.ToEfil())
+			}
+		})
+	}
+}
+
+func TestFindCycle(t *testing.T) {
+	for _, td := range []struct {
+		name     string
+		rule     string
+		input    string
+		maxSteps uint
+		// expected is nil if no cycle is found.
+		expected *Cycle
+	}{
+		{
+			name:     "block",
+			input:    "4x4 plane\n++++\n+##+\n+##+\n++++\n",
+			maxSteps: 10,
+			expected: &Cycle{Start: 0, Period: 1},
+		},
+		{
+			name:     "blinker",
+			input:    "5x5 plane\n+++++\n+++++\n+###+\n+++++\n+++++\n",
+			maxSteps: 10,
+			expected: &Cycle{Start: 0, Period: 2},
+		},
+		{
+			name:     "dying",
+			input:    "3x3 plane\n+++\n+#+\n+++\n",
+			maxSteps: 10,
+			expected: &Cycle{Start: 1, Period: 1},
+		},
+		{
+			name:     "glider",
+			input:    "8x8\n++++++++\n+#++++++\n++#+++++\n###+++++\n++++++++\n++++++++\n++++++++\n++++++++\n",
+			maxSteps: 32,
+			expected: &Cycle{Start: 0, Period: 32},
+		},
+		{
+			name:     "glider too far",
+			input:    "8x8\n++++++++\n+#++++++\n++#+++++\n###+++++\n++++++++\n++++++++\n++++++++\n++++++++\n",
+			maxSteps: 31,
+		},
+		{
+			name:     "strobing background",
+			rule:     "B013/S012",
+			input:    "3x3 plane\n+++\n+++\n+++\n",
+			maxSteps: 10,
+			expected: &Cycle{Start: 0, Period: 2},
+		},
+		{
+			name:     "dying states",
+			rule:     "B2/S/C3",
+			input:    "4x1 plane\n+##+\n",
+			maxSteps: 10,
+			expected: &Cycle{Start: 2, Period: 1},
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			g, err := Parse([]byte(td.input))
+			if err != nil {
+				t.Fatalf("cannot parse testdata: %v", err)
+			}
+			if td.rule != "" {
+				g.SetRule(parseRule(td.rule, t))
+			}
+			got, err := g.FindCycle(td.maxSteps)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			switch {
+			case td.expected == nil && got != nil:
+				t.Errorf("expected no cycle, got %+v", *got)
+			case td.expected != nil && got == nil:
+				t.Errorf("expected %+v, got no cycle", *td.expected)
+			case td.expected != nil && *got != *td.expected:
+				t.Errorf("expected %+v, got %+v", *td.expected, *got)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package solver
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pawelz/efilfoemag/src/cnf"
+	"github.com/pawelz/efilfoemag/src/grid"
+	"github.com/pawelz/efilfoemag/src/sat"
+	"github.com/pawelz/efilfoemag/src/state"
+)
+
+// Strategy is a method of searching for parents.
+//
+// All strategies give the same answer: a parent, or nil and no error iff the
+// target is a Garden of Eden. They differ in speed.
+type Strategy interface {
+	Solve(target *grid.Grid) (*grid.Grid, error)
+}
+
+// SymmetricStrategy is a Strategy which can restrict the parents to a symmetry.
+type SymmetricStrategy interface {
+	Strategy
+	// SolveSymmetric is Solve, but for the parents invariant under the
+	// symmetry. It returns an error if the symmetry does not fit the
+	// target, see grid.Symmetry.Check.
+	SolveSymmetric(target *grid.Grid, symmetry *grid.Symmetry) (*grid.Grid, error)
+}
+
+// Backtrack is the backtracking search over the candidate neighborhoods of the cells, see Solve.
+type Backtrack struct{}
+
+// Solve implements Strategy.
+func (Backtrack) Solve(target *grid.Grid) (*grid.Grid, error) {
+	return Solve(target)
+}
+
+// SolveSymmetric implements SymmetricStrategy.
+func (Backtrack) SolveSymmetric(target *grid.Grid, symmetry *grid.Symmetry) (*grid.Grid, error) {
+	return SolveSymmetric(target, symmetry)
+}
+
+// SAT encodes the predecessor problem with cnf.Encode and solves it with the built-in CDCL solver.
+type SAT struct{}
+
+// Solve implements Strategy.
+func (SAT) Solve(target *grid.Grid) (*grid.Grid, error) {
+	return solveSAT(target, nil)
+}
+
+// SolveSymmetric implements SymmetricStrategy. The parents are constrained with cnf.EncodeSymmetric.
+func (SAT) SolveSymmetric(target *grid.Grid, symmetry *grid.Symmetry) (*grid.Grid, error) {
+	return solveSAT(target, symmetry)
+}
+
+// solveSAT implements SAT. Unless the symmetry is nil, the parents must be invariant under it.
+func solveSAT(target *grid.Grid, symmetry *grid.Symmetry) (*grid.Grid, error) {
+	s, ok, err := newSATSolver(target, symmetry)
+	if err != nil || !ok {
+		return nil, err
+	}
+	if !s.Solve() {
+		return nil, nil
+	}
+	return satParent(s, target)
+}
+
+// newSATSolver returns a SAT solver loaded with the predecessor problem of the target.
+//
+// Unless the symmetry is nil, the parents must be invariant under it. It
+// returns false if the problem turned out unsatisfiable while it was loaded.
+func newSATSolver(target *grid.Grid, symmetry *grid.Symmetry) (*sat.Solver, bool, error) {
+	f, err := cnf.Encode(target)
+	if symmetry != nil {
+		f, err = cnf.EncodeSymmetric(target, symmetry)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("cannot encode the target: %v", err)
+	}
+	return loadSATSolver(f)
+}
+
+// loadSATSolver returns a SAT solver loaded with the formula.
+//
+// It returns false if the formula turned out unsatisfiable while it was
+// loaded.
+func loadSATSolver(f *cnf.Formula) (*sat.Solver, bool, error) {
+	s := sat.New(f.NumVars)
+	for _, clause := range f.Clauses {
+		ok, err := s.AddClause(clause)
+		if err != nil {
+			return nil, false, fmt.Errorf("cannot add a clause: %v", err)
+		}
+		if !ok {
+			return nil, false, nil
+		}
+	}
+	return s, true, nil
+}
+
+// satParent reads the parent of the target out of the model found by the SAT solver.
+func satParent(s *sat.Solver, target *grid.Grid) (*grid.Grid, error) {
+	w, h := target.Width(), target.Height()
+	parent := target.Blank()
+	for y := uint(0); y < h; y++ {
+		for x := uint(0); x < w; x++ {
+			if err := parent.Set(x, y, state.Of(s.Value(cnf.Var(w, x, y)))); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := FillDying(parent, target); err != nil {
+		return nil, err
+	}
+	return parent, nil
+}
+
+var strategies = map[string]Strategy{
+	"backtrack": Backtrack{},
+	"rows":      Rows{},
+	"sat":       SAT{},
+}
+
+// StrategyByName returns the strategy of the given name, see StrategyNames.
+func StrategyByName(name string) (Strategy, error) {
+	s, ok := strategies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy %q, want one of %v", name, StrategyNames())
+	}
+	return s, nil
+}
+
+// StrategyNames returns the names of all strategies in the alphabetical order.
+func StrategyNames() []string {
+	var rv []string
+	for name := range strategies {
+		rv = append(rv, name)
+	}
+	sort.Strings(rv)
+	return rv
+}
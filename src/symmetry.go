@@ -0,0 +1,199 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grid
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pawelz/efilfoemag/src/neighborhood"
+	"github.com/pawelz/efilfoemag/src/state"
+)
+
+// transform is a symmetry of the square: the transposition along the NW-SE
+// diagonal, if transpose, followed by the mirroring of the x coordinate, if
+// flipX, and of the y one, if flipY.
+type transform struct {
+	transpose, flipX, flipY bool
+}
+
+// apply returns the address that the cell at (x, y) of a grid of the given size is moved to.
+//
+// The address may be out of range. The grid must be square if the transform
+// transposes it.
+func (t transform) apply(x, y int, width, height uint) (int, int) {
+	if t.transpose {
+		x, y = y, x
+	}
+	if t.flipX {
+		x = int(width) - 1 - x
+	}
+	if t.flipY {
+		y = int(height) - 1 - y
+	}
+	return x, y
+}
+
+// offset returns the offset between two cells after the transform, given the one before.
+func (t transform) offset(dx, dy int) (int, int) {
+	if t.transpose {
+		dx, dy = dy, dx
+	}
+	if t.flipX {
+		dx = -dx
+	}
+	if t.flipY {
+		dy = -dy
+	}
+	return dx, dy
+}
+
+// neighborhood returns the neighborhood moved by the transform.
+func (t transform) neighborhood(n neighborhood.Neighborhood) neighborhood.Neighborhood {
+	var rv neighborhood.Neighborhood
+	for _, side := range neighborhood.Sides() {
+		dx, dy := t.offset(side.Offset())
+		rv.Set(neighborhood.Side(4-dx-3*dy), state.Of(n>>uint(side)&1 != 0))
+	}
+	return rv
+}
+
+// Symmetry is a group of symmetries of the square, under which a grid may be invariant.
+//
+// A grid is invariant iff every cell has the same state as the ones it is
+// moved to by the symmetries of the group.
+type Symmetry struct {
+	name string
+	// transforms are the symmetries of the group other than the identity.
+	transforms []transform
+}
+
+var (
+	// C2 is the rotation by 180 degrees.
+	C2 = &Symmetry{name: "C2", transforms: []transform{{flipX: true, flipY: true}}}
+	// C4 are the rotations by 90 degrees. The grid must be square.
+	C4 = &Symmetry{name: "C4", transforms: []transform{{transpose: true, flipX: true}, {flipX: true, flipY: true}, {transpose: true, flipY: true}}}
+	// D2 is the mirroring along the vertical axis, i.e. the left and the right halves are mirrored.
+	D2 = &Symmetry{name: "D2", transforms: []transform{{flipX: true}}}
+	// D4 are the mirrorings along both the vertical and the horizontal axes.
+	D4 = &Symmetry{name: "D4", transforms: []transform{{flipX: true}, {flipY: true}, {flipX: true, flipY: true}}}
+	// Diagonal is the mirroring along the NW-SE diagonal. The grid must be square.
+	Diagonal = &Symmetry{name: "diagonal", transforms: []transform{{transpose: true}}}
+
+	symmetries = []*Symmetry{C2, C4, D2, D4, Diagonal}
+)
+
+// String returns the name of the symmetry, see SymmetryByName.
+func (s *Symmetry) String() string {
+	return s.name
+}
+
+// SymmetryByName returns the symmetry of the given name, see SymmetryNames.
+func SymmetryByName(name string) (*Symmetry, error) {
+	for _, s := range symmetries {
+		if s.name == name {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown symmetry %q, want one of %v", name, SymmetryNames())
+}
+
+// SymmetryNames returns the names of all symmetries in the alphabetical order.
+func SymmetryNames() []string {
+	var rv []string
+	for _, s := range symmetries {
+		rv = append(rv, s.name)
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+// Representative returns the first cell, in the row-major order, of the ones that the cell at (x, y) is moved to by the symmetry.
+//
+// All the cells of an invariant grid of the given size have the states of
+// their representatives.
+func (s *Symmetry) Representative(x, y, width, height uint) (uint, uint) {
+	rx, ry := x, y
+	for _, t := range s.transforms {
+		tx, ty := t.apply(int(x), int(y), width, height)
+		if uint(ty) < ry || uint(ty) == ry && uint(tx) < rx {
+			rx, ry = uint(tx), uint(ty)
+		}
+	}
+	return rx, ry
+}
+
+// Check returns an error if the grid, or its parents, cannot be invariant under the symmetry.
+//
+// The symmetries transposing the grid need a square one. The topology and the
+// rule of the grid must be symmetric too, so that the symmetric parents evolve
+// into symmetric grids. So the grid itself must be invariant, otherwise it has
+// no symmetric parents.
+func (s *Symmetry) Check(g *Grid) error {
+	w, h := g.width, g.height
+	rule := g.Rule()
+	for _, t := range s.transforms {
+		if t.transpose && w != h {
+			return fmt.Errorf("the %s symmetry needs a square grid, got %dx%d", s, w, h)
+		}
+		if !t.preserves(g.Topology(), w, h) {
+			return fmt.Errorf("the %s topology is not symmetric under %s", g.Topology(), s)
+		}
+		shape := neighborhood.Neighborhood(rule.Shape())
+		if t.neighborhood(shape) != shape {
+			return fmt.Errorf("the %s rule is not symmetric under %s", rule, s)
+		}
+		for n := neighborhood.Neighborhood(0); n < 0x200; n++ {
+			if rule.Shape().Contains(n) && rule.Next(n) != rule.Next(t.neighborhood(n)) {
+				return fmt.Errorf("the %s rule is not symmetric under %s", rule, s)
+			}
+		}
+		for y := uint(0); y < h; y++ {
+			for x := uint(0); x < w; x++ {
+				tx, ty := t.apply(int(x), int(y), w, h)
+				got, _ := g.Get(uint(tx), uint(ty))
+				if want, _ := g.Get(x, y); got != want {
+					return fmt.Errorf("the grid is not symmetric under %s: cell (%d, %d) is %s, but (%d, %d) is %s", s, x, y, want.ToStr(), tx, ty, got.ToStr())
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// preserves returns true iff the transform moves the neighbours of every cell of the grid of the given size to the neighbours of the cell it is moved to.
+func (t transform) preserves(topology Topology, width, height uint) bool {
+	for y := 0; y < int(height); y++ {
+		for x := 0; x < int(width); x++ {
+			tx, ty := t.apply(x, y, width, height)
+			for _, side := range neighborhood.Sides() {
+				dx, dy := side.Offset()
+				nx, ny, ok := topology.Resolve(x+dx, y+dy, width, height)
+				tdx, tdy := t.offset(dx, dy)
+				mx, my, tok := topology.Resolve(tx+tdx, ty+tdy, width, height)
+				if ok != tok {
+					return false
+				}
+				if !ok {
+					continue
+				}
+				if ax, ay := t.apply(int(nx), int(ny), width, height); uint(ax) != mx || uint(ay) != my {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
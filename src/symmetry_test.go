@@ -0,0 +1,124 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grid
+
+import (
+	"testing"
+
+	"github.com/pawelz/efilfoemag/src/neighborhood"
+)
+
+func TestRepresentative(t *testing.T) {
+	for _, td := range []struct {
+		symmetry *Symmetry
+		x, y     uint
+		// rx, ry is the representative in a 8x8 grid.
+		rx, ry uint
+	}{
+		{symmetry: C2, x: 7, y: 7, rx: 0, ry: 0},
+		{symmetry: C2, x: 1, y: 6, rx: 6, ry: 1},
+		{symmetry: C4, x: 1, y: 6, rx: 1, ry: 1},
+		{symmetry: C4, x: 5, y: 2, rx: 2, ry: 2},
+		{symmetry: D2, x: 5, y: 6, rx: 2, ry: 6},
+		{symmetry: D2, x: 2, y: 6, rx: 2, ry: 6},
+		{symmetry: D4, x: 5, y: 6, rx: 2, ry: 1},
+		{symmetry: Diagonal, x: 2, y: 6, rx: 6, ry: 2},
+		{symmetry: Diagonal, x: 3, y: 3, rx: 3, ry: 3},
+	} {
+		t.Run(td.symmetry.String(), func(t *testing.T) {
+			if rx, ry := td.symmetry.Representative(td.x, td.y, 8, 8); rx != td.rx || ry != td.ry {
+				t.Errorf("Representative(%d, %d): expected (%d, %d), got (%d, %d)", td.x, td.y, td.rx, td.ry, rx, ry)
+			}
+		})
+	}
+}
+
+func TestSymmetryCheck(t *testing.T) {
+	// d8 is invariant under all the symmetries.
+	d8 := `
+++++++++
++##++##+
++#++++#+
+++++++++
+++++++++
++#++++#+
++##++##+
+++++++++
+`
+	// c2 is only invariant under C2.
+	c2 := `
+##++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++++
+++++++##
+`
+	for _, td := range []struct {
+		name     string
+		symmetry string
+		// rule is Conway's if empty.
+		rule    string
+		input   string
+		failure bool
+	}{
+		{name: "C2", symmetry: "C2", input: "8x8" + d8},
+		{name: "C4", symmetry: "C4", input: "8x8 plane" + d8},
+		{name: "D2", symmetry: "D2", input: "8x8 cylinder" + d8},
+		{name: "D4", symmetry: "D4", input: "8x8" + d8},
+		{name: "diagonal", symmetry: "diagonal", input: "8x8" + d8},
+		{name: "C2 only", symmetry: "C2", input: "8x8" + c2},
+		{name: "not C4", symmetry: "C4", input: "8x8" + c2, failure: true},
+		{name: "not D2", symmetry: "D2", input: "8x8" + c2, failure: true},
+		{name: "not square", symmetry: "diagonal", input: "16x8\n" + "++++++++++++++++\n" + "++++++++++++++++\n" + "++++++++++++++++\n" + "++++++++++++++++\n" + "++++++++++++++++\n" + "++++++++++++++++\n" + "++++++++++++++++\n" + "++++++++++++++++\n", failure: true},
+		{name: "cylinder", symmetry: "C4", input: "8x8 cylinder" + d8, failure: true},
+		// The Klein bottle mirrors the rows crossing the top edge, so the
+		// mirrored grid crosses it at other cells.
+		{name: "klein bottle", symmetry: "D4", input: "8x8 klein" + d8},
+		{name: "klein bottle", symmetry: "diagonal", input: "8x8 klein" + d8, failure: true},
+		{name: "hexagonal", symmetry: "C2", rule: "B2/S34H", input: "8x8" + d8},
+		{name: "hexagonal", symmetry: "D2", rule: "B2/S34H", input: "8x8" + d8, failure: true},
+		// The majority of N, W and C is only symmetric along the diagonal.
+		{name: "not isotropic", symmetry: "C2", rule: "MAPAAAAAAAA//8AAAAAAAD//wAA////////AAD///////8AAAAAAAD//wAAAAAAAP//AAD///////8AAP///////w", input: "8x8" + d8, failure: true},
+		{name: "not isotropic", symmetry: "diagonal", rule: "MAPAAAAAAAA//8AAAAAAAD//wAA////////AAD///////8AAAAAAAD//wAAAAAAAP//AAD///////8AAP///////w", input: "8x8" + d8},
+	} {
+		t.Run(td.name+"/"+td.symmetry, func(t *testing.T) {
+			s, err := SymmetryByName(td.symmetry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			g, err := Parse([]byte(td.input))
+			if err != nil {
+				t.Fatalf("cannot parse testdata: %v", err)
+			}
+			if td.rule != "" {
+				r, err := neighborhood.ParseRule(td.rule)
+				if err != nil {
+					t.Fatalf("cannot parse testdata: %v", err)
+				}
+				g.SetRule(r)
+			}
+			err = s.Check(g)
+			if td.failure && err == nil {
+				t.Errorf("expected a failure")
+			}
+			if !td.failure && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grid
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Topology tells what lies beyond the edges of a grid.
+type Topology interface {
+	// Resolve returns the cell of the grid of the given size found at the
+	// address (x, y), which may be out of range. It returns false if there
+	// is no such cell, i.e. the address lies outside of the grid and is
+	// always dead.
+	Resolve(x, y int, width, height uint) (uint, uint, bool)
+	// String returns the name of the topology, see TopologyByName.
+	String() string
+}
+
+// edge tells what happens to an address crossing an edge of the grid.
+type edge int
+
+const (
+	// dead edges are not crossed: there are only dead cells beyond them.
+	dead edge = iota
+	// wrap edges lead to the opposite edge.
+	wrap
+	// flip edges lead to the opposite edge, mirrored.
+	flip
+)
+
+// gluing is a Topology made by gluing the opposite edges of the grid.
+//
+// The x edges are the left and the right ones. Crossing a flip x edge mirrors
+// the y coordinate, and crossing a flip y edge mirrors the x one.
+type gluing struct {
+	name string
+	x, y edge
+}
+
+var (
+	// Torus glues both pairs of the opposite edges. This is the default.
+	Torus Topology = &gluing{name: "torus", x: wrap, y: wrap}
+	// Plane is a grid surrounded by dead cells.
+	Plane Topology = &gluing{name: "plane", x: dead, y: dead}
+	// Cylinder glues the left edge to the right one, and is surrounded by dead cells at the top and the bottom.
+	Cylinder Topology = &gluing{name: "cylinder", x: wrap, y: dead}
+	// KleinBottle glues the left edge to the right one, and the top edge to the mirrored bottom one.
+	KleinBottle Topology = &gluing{name: "klein", x: wrap, y: flip}
+	// ProjectivePlane glues both pairs of the opposite edges mirrored.
+	//
+	// The corners of the grid are singular there: the address crossing both
+	// edges at once is resolved crossing the x edge first.
+	ProjectivePlane Topology = &gluing{name: "projective", x: flip, y: flip}
+
+	topologies = []Topology{Torus, Plane, Cylinder, KleinBottle, ProjectivePlane}
+)
+
+// Resolve implements Topology.
+func (g *gluing) Resolve(x, y int, width, height uint) (uint, uint, bool) {
+	w, h := int(width), int(height)
+	for x < 0 || x >= w {
+		switch g.x {
+		case dead:
+			return 0, 0, false
+		case flip:
+			y = h - 1 - y
+		}
+		if x < 0 {
+			x += w
+		} else {
+			x -= w
+		}
+	}
+	for y < 0 || y >= h {
+		switch g.y {
+		case dead:
+			return 0, 0, false
+		case flip:
+			x = w - 1 - x
+		}
+		if y < 0 {
+			y += h
+		} else {
+			y -= h
+		}
+	}
+	return uint(x), uint(y), true
+}
+
+// String implements Topology.
+func (g *gluing) String() string {
+	return g.name
+}
+
+// TopologyByName returns the topology of the given name, see TopologyNames.
+func TopologyByName(name string) (Topology, error) {
+	for _, t := range topologies {
+		if t.String() == name {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown topology %q, want one of %v", name, TopologyNames())
+}
+
+// TopologyNames returns the names of all topologies in the alphabetical order.
+func TopologyNames() []string {
+	var rv []string
+	for _, t := range topologies {
+		rv = append(rv, t.String())
+	}
+	sort.Strings(rv)
+	return rv
+}
@@ -0,0 +1,323 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grid
+
+import (
+	"fmt"
+	mathbits "math/bits"
+	"sort"
+
+	"github.com/pawelz/efilfoemag/src/state"
+)
+
+// Transform is one of the 8 symmetries of the square, which a grid can be transformed by, see Grid.Transform.
+type Transform struct {
+	name string
+	t    transform
+}
+
+var (
+	// Identity leaves the grid as it is.
+	Identity = &Transform{name: "identity"}
+	// Rotate90 rotates the grid by 90 degrees clockwise.
+	Rotate90 = &Transform{name: "rotate90", t: transform{transpose: true, flipX: true}}
+	// Rotate180 rotates the grid by 180 degrees.
+	Rotate180 = &Transform{name: "rotate180", t: transform{flipX: true, flipY: true}}
+	// Rotate270 rotates the grid by 90 degrees counterclockwise.
+	Rotate270 = &Transform{name: "rotate270", t: transform{transpose: true, flipY: true}}
+	// FlipX mirrors the x coordinate, swapping the left and the right edges.
+	FlipX = &Transform{name: "flip-x", t: transform{flipX: true}}
+	// FlipY mirrors the y coordinate, swapping the top and the bottom edges.
+	FlipY = &Transform{name: "flip-y", t: transform{flipY: true}}
+	// FlipDiagonal mirrors the grid along the NW-SE diagonal, see Grid.Transpose.
+	FlipDiagonal = &Transform{name: "flip-diagonal", t: transform{transpose: true}}
+	// FlipAntidiagonal mirrors the grid along the NE-SW diagonal.
+	FlipAntidiagonal = &Transform{name: "flip-antidiagonal", t: transform{transpose: true, flipX: true, flipY: true}}
+
+	allTransforms = []*Transform{Identity, Rotate90, Rotate180, Rotate270, FlipX, FlipY, FlipDiagonal, FlipAntidiagonal}
+)
+
+// String returns the name of the transform, see TransformByName.
+func (t *Transform) String() string {
+	return t.name
+}
+
+// TransformByName returns the transform of the given name, see TransformNames.
+func TransformByName(name string) (*Transform, error) {
+	for _, t := range allTransforms {
+		if t.name == name {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown transform %q, want one of %v", name, TransformNames())
+}
+
+// TransformNames returns the names of all transforms in the alphabetical order.
+func TransformNames() []string {
+	var rv []string
+	for _, t := range allTransforms {
+		rv = append(rv, t.name)
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+// Transform returns a new grid transformed by the given symmetry of the square.
+//
+// The width and the height are swapped by the transforms transposing the
+// grid. As with Transpose, the topology and the rule are copied as they are.
+func (c *Grid) Transform(t *Transform) *Grid {
+	var rv *Grid
+	if t.t.transpose {
+		rv = c.Transpose()
+	} else {
+		rv = c.Copy()
+	}
+	if t.t.flipX {
+		rv.flipX()
+	}
+	if t.t.flipY {
+		rv.flipY()
+	}
+	return rv
+}
+
+// flipX mirrors the x coordinate of the grid in place.
+func (c *Grid) flipX() {
+	n := c.rowBytes()
+	// The row reversed starts with the padding.
+	padding := 8*n - c.width
+	reversed := make([]uint8, n)
+	for y := uint(0); y < c.height; y++ {
+		row := c.row(y)
+		for i, octet := range row {
+			reversed[n-1-uint(i)] = mathbits.Reverse8(octet)
+		}
+		copyCells(row, 0, reversed, padding, c.width)
+		if c.dying != nil {
+			dying := c.dying[y*c.width : (y+1)*c.width]
+			for i, j := 0, len(dying)-1; i < j; i, j = i+1, j-1 {
+				dying[i], dying[j] = dying[j], dying[i]
+			}
+		}
+	}
+}
+
+// flipY mirrors the y coordinate of the grid in place.
+func (c *Grid) flipY() {
+	n := c.rowBytes()
+	for y, z := uint(0), c.height-1; y < z; y, z = y+1, z-1 {
+		for i := uint(0); i < n; i++ {
+			c.b[y*n+i], c.b[z*n+i] = c.b[z*n+i], c.b[y*n+i]
+		}
+		if c.dying != nil {
+			for x := uint(0); x < c.width; x++ {
+				c.dying[y*c.width+x], c.dying[z*c.width+x] = c.dying[z*c.width+x], c.dying[y*c.width+x]
+			}
+		}
+	}
+}
+
+// transpose8 transposes the 8x8 block of cells, the row i in the byte i from the most significant one.
+func transpose8(x uint64) uint64 {
+	t := (x ^ x>>7) & 0x00aa00aa00aa00aa
+	x ^= t ^ t<<7
+	t = (x ^ x>>14) & 0x0000cccc0000cccc
+	x ^= t ^ t<<14
+	t = (x ^ x>>28) & 0x00000000f0f0f0f0
+	return x ^ t ^ t<<28
+}
+
+// row returns the bytes of the living cells of the given row, see Row, without copying them.
+func (c *Grid) row(y uint) []uint8 {
+	start := c.byteshift(0, y)
+	return c.b[start : start+c.rowBytes()]
+}
+
+// copyCells copies n cells of the row src, from the cell srcX on, to the row dst, from the cell dstX on.
+//
+// The rows are the bytes of the living cells, as in Row. Up to 8 cells are
+// copied at a time, and the other cells of dst are left as they are.
+func copyCells(dst []uint8, dstX uint, src []uint8, srcX, n uint) {
+	for n > 0 {
+		shift := dstX % 8
+		k := 8 - shift
+		if k > n {
+			k = n
+		}
+		// v holds the cells of src from srcX on, in the reading order.
+		v := src[srcX/8] << (srcX % 8)
+		if srcX%8 != 0 && srcX/8+1 < uint(len(src)) {
+			v |= src[srcX/8+1] >> (8 - srcX%8)
+		}
+		mask := uint8(0xff) << (8 - k) >> shift
+		dst[dstX/8] = dst[dstX/8]&^mask | v>>shift&mask
+		dstX, srcX, n = dstX+k, srcX+k, n-k
+	}
+}
+
+// copyRow copies n cells of the row srcY of src, from the cell srcX on, to the row dstY of c, from the cell dstX on.
+//
+// The dying states are copied too.
+func (c *Grid) copyRow(dstX, dstY uint, src *Grid, srcX, srcY, n uint) {
+	copyCells(c.row(dstY), dstX, src.row(srcY), srcX, n)
+	if src.dying == nil && c.dying == nil {
+		return
+	}
+	for i := uint(0); i < n; i++ {
+		s := state.Dead
+		if src.dying != nil {
+			s = state.State(src.dying[srcY*src.width+srcX+i])
+		}
+		c.setDying(dstX+i, dstY, s)
+	}
+}
+
+// resized returns a blank grid of the given size, with the same topology, rule and background.
+func (c *Grid) resized(width, height uint) *Grid {
+	return &Grid{
+		width:      width,
+		height:     height,
+		b:          make([]uint8, (width+7)/8*height),
+		topology:   c.topology,
+		rule:       c.rule,
+		background: c.background,
+	}
+}
+
+// Translate returns a new grid with every cell moved by dx to the right and dy down.
+//
+// The translation is cyclic, as on a torus: the cells moved beyond an edge
+// come back at the opposite one, whatever the topology of the grid.
+func (c *Grid) Translate(dx, dy int) *Grid {
+	rv := c.Blank()
+	sx, sy := uint(mod(dx, c.width)), uint(mod(dy, c.height))
+	for y := uint(0); y < c.height; y++ {
+		ty := (y + sy) % c.height
+		rv.copyRow(sx, ty, c, 0, y, c.width-sx)
+		rv.copyRow(0, ty, c, c.width-sx, y, sx)
+	}
+	return rv
+}
+
+// mod returns d modulo n, between 0 and n-1.
+func mod(d int, n uint) int {
+	return (d%int(n) + int(n)) % int(n)
+}
+
+// differs returns the byte of the cells of the row differing from the background, from the byte i on.
+//
+// The padding of the last byte is 0. The dying cells differ from either
+// background.
+func (c *Grid) differs(y, i uint) uint8 {
+	rv := c.b[c.byteshift(8*i, y)]
+	if c.background.IsAlive() {
+		rv = ^rv
+	}
+	if rest := c.width - 8*i; rest < 8 {
+		rv &= 0xff << (8 - rest)
+	}
+	if c.dying != nil {
+		for x := 8 * i; x < 8*i+8 && x < c.width; x++ {
+			if c.dying[y*c.width+x] != 0 {
+				rv |= bitmask(x)
+			}
+		}
+	}
+	return rv
+}
+
+// Bounds returns the smallest rectangle holding all the cells which differ from the Background, as the address of its top-left corner and its size.
+//
+// These are the living and the dying cells, unless the background is alive.
+// It returns false if there are no such cells.
+func (c *Grid) Bounds() (x, y, width, height uint, ok bool) {
+	x0, y0, x1, y1 := c.width, c.height, uint(0), uint(0)
+	for y := uint(0); y < c.height; y++ {
+		for i := uint(0); i < c.rowBytes(); i++ {
+			d := c.differs(y, i)
+			if d == 0 {
+				continue
+			}
+			if first := 8*i + uint(mathbits.LeadingZeros8(d)); first < x0 {
+				x0 = first
+			}
+			if last := 8*i + 7 - uint(mathbits.TrailingZeros8(d)); last > x1 {
+				x1 = last
+			}
+			if y < y0 {
+				y0 = y
+			}
+			y1 = y
+		}
+	}
+	if y0 == c.height {
+		return 0, 0, 0, 0, false
+	}
+	return x0, y0, x1 - x0 + 1, y1 - y0 + 1, true
+}
+
+// Crop returns a new grid made of the rectangle of the cells with the top-left corner at (x, y) and the given size.
+//
+// The rectangle must lie within the grid. The topology, the rule and the
+// background are copied as they are.
+func (c *Grid) Crop(x, y, width, height uint) (*Grid, error) {
+	if width == 0 || height == 0 || x+width > c.width || y+height > c.height {
+		return nil, fmt.Errorf("cannot Crop: rectangle %dx%d at (%d, %d) does not fit in the grid %dx%d", width, height, x, y, c.width, c.height)
+	}
+	rv := c.resized(width, height)
+	for i := uint(0); i < height; i++ {
+		rv.copyRow(0, i, c, x, y+i, width)
+	}
+	return rv, nil
+}
+
+// Pad returns a new grid with the given numbers of cells added at the left, the top, the right and the bottom edges.
+//
+// The cells added are the Background, i.e. they are dead unless the
+// background is alive, so that the pattern is the same.
+func (c *Grid) Pad(left, top, right, bottom uint) *Grid {
+	rv := c.resized(c.width+left+right, c.height+top+bottom)
+	if c.background.IsAlive() {
+		for y := uint(0); y < rv.height; y++ {
+			row := rv.row(y)
+			for i := range row {
+				row[i] = 0xff
+			}
+			if rest := rv.width % 8; rest != 0 {
+				row[len(row)-1] = 0xff << (8 - rest)
+			}
+		}
+	}
+	for y := uint(0); y < c.height; y++ {
+		rv.copyRow(left, top+y, c, 0, y, c.width)
+	}
+	return rv
+}
+
+// Embed returns a copy of the grid with the cells of the other grid pasted at the given address of its top-left corner.
+//
+// The other grid must fit within the grid. Only its cells are pasted: the
+// topology, the rule and the background of the grid are left as they are.
+func (c *Grid) Embed(other *Grid, x, y uint) (*Grid, error) {
+	if x+other.width > c.width || y+other.height > c.height {
+		return nil, fmt.Errorf("cannot Embed: the grid %dx%d at (%d, %d) does not fit in the grid %dx%d", other.width, other.height, x, y, c.width, c.height)
+	}
+	rv := c.Copy()
+	for i := uint(0); i < other.height; i++ {
+		rv.copyRow(x, y+i, other, 0, i, other.width)
+	}
+	return rv, nil
+}
@@ -0,0 +1,228 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grid
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/pawelz/efilfoemag/src/state"
+)
+
+// randomGrid returns a grid of the given size with random living cells, and a few dying ones if dying.
+func randomGrid(width, height int, dying bool, r *rand.Rand, t *testing.T) *Grid {
+	t.Helper()
+	g, err := New(width, height)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := uint(0); y < g.Height(); y++ {
+		for x := uint(0); x < g.Width(); x++ {
+			s := state.Of(r.Intn(2) == 0)
+			if dying && r.Intn(8) == 0 {
+				s = 2
+			}
+			g.Set(x, y, s)
+		}
+	}
+	return g
+}
+
+var transformSizes = [][2]int{{1, 1}, {3, 5}, {8, 8}, {13, 9}, {17, 20}, {64, 3}}
+
+func TestTransform(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, tr := range allTransforms {
+		for _, size := range transformSizes {
+			t.Run(fmt.Sprintf("%s/%dx%d", tr, size[0], size[1]), func(t *testing.T) {
+				g := randomGrid(size[0], size[1], size[0] == 13, r, t)
+				got := g.Transform(tr)
+				w, h := g.Width(), g.Height()
+				if tr.t.transpose {
+					w, h = h, w
+				}
+				if got.Width() != w || got.Height() != h {
+					t.Fatalf("expected %dx%d, got %dx%d", w, h, got.Width(), got.Height())
+				}
+				for y := uint(0); y < g.Height(); y++ {
+					for x := uint(0); x < g.Width(); x++ {
+						tx, ty := x, y
+						if tr.t.transpose {
+							tx, ty = y, x
+						}
+						if tr.t.flipX {
+							tx = w - 1 - tx
+						}
+						if tr.t.flipY {
+							ty = h - 1 - ty
+						}
+						want, _ := g.Get(x, y)
+						if s, _ := got.Get(tx, ty); s != want {
+							t.Fatalf("cell (%d, %d) moved to (%d, %d) is %s, want %s", x, y, tx, ty, s.ToStr(), want.ToStr())
+						}
+					}
+				}
+				// The padding stays 0, so that the equal grids compare equal.
+				if back := got.Transform(inverse(tr)); !back.EqualsTo(g) {
+					t.Errorf("transforming back gives:\n%s\nwant:\n%s", back.ToEfil(), g.ToEfil())
+				}
+			})
+		}
+	}
+}
+
+// inverse returns the transform undoing the given one.
+func inverse(tr *Transform) *Transform {
+	switch tr {
+	case Rotate90:
+		return Rotate270
+	case Rotate270:
+		return Rotate90
+	}
+	return tr
+}
+
+func TestRotate90(t *testing.T) {
+	g, err := Parse([]byte("3x2 cylinder\n##+\n+A+\n"))
+	if err != nil {
+		t.Fatalf("cannot parse testdata: %v", err)
+	}
+	expected := "2x3 cylinder\n+#\nA#\n++\n"
+	if got := g.Transform(Rotate90).ToEfil(); string(got) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, size := range transformSizes {
+		for _, d := range [][2]int{{0, 0}, {1, 0}, {0, -1}, {-3, 7}, {70, -20}} {
+			t.Run(fmt.Sprintf("%dx%d/%d,%d", size[0], size[1], d[0], d[1]), func(t *testing.T) {
+				g := randomGrid(size[0], size[1], size[0] == 13, r, t)
+				got := g.Translate(d[0], d[1])
+				for y := uint(0); y < g.Height(); y++ {
+					for x := uint(0); x < g.Width(); x++ {
+						tx, ty := uint(mod(int(x)+d[0], g.Width())), uint(mod(int(y)+d[1], g.Height()))
+						want, _ := g.Get(x, y)
+						if s, _ := got.Get(tx, ty); s != want {
+							t.Fatalf("cell (%d, %d) moved to (%d, %d) is %s, want %s", x, y, tx, ty, s.ToStr(), want.ToStr())
+						}
+					}
+				}
+				if back := got.Translate(-d[0], -d[1]); !back.EqualsTo(g) {
+					t.Errorf("translating back gives:\n%s\nwant:\n%s", back.ToEfil(), g.ToEfil())
+				}
+			})
+		}
+	}
+}
+
+func TestBounds(t *testing.T) {
+	for _, td := range []struct {
+		name  string
+		input string
+		// expected is x, y, width and height.
+		expected [4]uint
+		ok       bool
+	}{
+		{
+			name:  "empty",
+			input: "3x2\n+++\n+++\n",
+		},
+		{
+			name:     "single cell",
+			input:    "10x3\n+++++++++#\n++++++++++\n++++++++++\n",
+			expected: [4]uint{9, 0, 1, 1},
+			ok:       true,
+		},
+		{
+			name:     "across bytes",
+			input:    "20x4\n++++++++++++++++++++\n++++++#+++++++++++++\n++++++++++++#+++++++\n++++++++++++++++++++\n",
+			expected: [4]uint{6, 1, 7, 2},
+			ok:       true,
+		},
+		{
+			name:     "dying",
+			input:    "9x3\n+++++++++\n++++++++B\n+#+++++++\n",
+			expected: [4]uint{1, 1, 8, 2},
+			ok:       true,
+		},
+		{
+			name:     "alive background",
+			input:    "9x3 plane alive\n#########\n####+####\n#########\n",
+			expected: [4]uint{4, 1, 1, 1},
+			ok:       true,
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			g, err := Parse([]byte(td.input))
+			if err != nil {
+				t.Fatalf("cannot parse testdata: %v", err)
+			}
+			x, y, w, h, ok := g.Bounds()
+			if got := [4]uint{x, y, w, h}; got != td.expected || ok != td.ok {
+				t.Errorf("expected %v, %v, got %v, %v", td.expected, td.ok, got, ok)
+			}
+		})
+	}
+}
+
+func TestCropPadEmbed(t *testing.T) {
+	g, err := Parse([]byte("10x4 plane\n++++++++++\n++#+++++++\n+++#++++#+\n+###++++++\n"))
+	if err != nil {
+		t.Fatalf("cannot parse testdata: %v", err)
+	}
+	x, y, w, h, _ := g.Bounds()
+	cropped, err := g.Crop(x, y, w, h)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "8x3 plane\n+#++++++\n++#++++#\n###+++++\n"; string(cropped.ToEfil()) != want {
+		t.Errorf("Crop: expected:\n%s\ngot:\n%s", want, cropped.ToEfil())
+	}
+	if _, err := g.Crop(3, 0, 8, 1); err == nil {
+		t.Errorf("Crop: expected an error for a rectangle out of the grid")
+	}
+	padded := cropped.Pad(x, y, g.Width()-x-w, g.Height()-y-h)
+	if !padded.EqualsTo(g) {
+		t.Errorf("Pad: expected:\n%s\ngot:\n%s", g.ToEfil(), padded.ToEfil())
+	}
+	blank := g.Blank()
+	embedded, err := blank.Embed(cropped, x, y)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !embedded.EqualsTo(g) {
+		t.Errorf("Embed: expected:\n%s\ngot:\n%s", g.ToEfil(), embedded.ToEfil())
+	}
+	if _, err := blank.Embed(cropped, 3, 1); err == nil {
+		t.Errorf("Embed: expected an error for a grid out of the grid")
+	}
+	if !blank.EqualsTo(g.Blank()) {
+		t.Errorf("Embed: expected the grid to be left as it is")
+	}
+}
+
+func TestPadAliveBackground(t *testing.T) {
+	g, err := Parse([]byte("2x1 plane alive\n+#\n"))
+	if err != nil {
+		t.Fatalf("cannot parse testdata: %v", err)
+	}
+	want := "5x3 plane alive\n#####\n#+###\n#####\n"
+	if got := g.Pad(1, 1, 2, 1).ToEfil(); string(got) != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+}
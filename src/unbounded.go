@@ -0,0 +1,136 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package solver
+
+import (
+	"fmt"
+
+	"github.com/pawelz/efilfoemag/src/cnf"
+	"github.com/pawelz/efilfoemag/src/grid"
+	"github.com/pawelz/efilfoemag/src/sat"
+)
+
+// MarginStep is the step by which SolveUnbounded grows the margin, one cell on each side at a time.
+const MarginStep = 1
+
+// Unbounded is the result of SolveUnbounded.
+type Unbounded struct {
+	// Parent is a parent found within the Margin, or nil if there is none.
+	// Both the Parent and the Target are padded with Margin+1 cells on
+	// every side, and the outermost ring of the Parent is dead, so its
+	// living cells are at most Margin cells away from the target.
+	Parent *grid.Grid
+	// Target is the target padded with dead cells, see Parent.
+	Target *grid.Grid
+	// Margin is the margin of the last search.
+	Margin int
+	// Orphan is true iff the target is proven to have no parents, whatever
+	// the margin.
+	Orphan bool
+}
+
+// pad returns the grid surrounded with the given number of dead cells on every side, on the plane.
+func pad(g *grid.Grid, n uint) *grid.Grid {
+	rv := g.Pad(n, n, n, n)
+	rv.SetTopology(grid.Plane)
+	return rv
+}
+
+// solveUnbounded solves the predecessor problem of the padded target with the outermost ring of the parent dead.
+//
+// If relaxed, the outermost ring of the target is "don't care" instead, and
+// the parent is left free there.
+func solveUnbounded(padded *grid.Grid, relaxed bool) (*grid.Grid, error) {
+	w, h := padded.Width(), padded.Height()
+	p := grid.NewPattern(padded)
+	var ring [][2]uint
+	for y := uint(0); y < h; y++ {
+		for x := uint(0); x < w; x++ {
+			if x == 0 || y == 0 || x == w-1 || y == h-1 {
+				ring = append(ring, [2]uint{x, y})
+			}
+		}
+	}
+	if relaxed {
+		for _, c := range ring {
+			if err := p.Release(c[0], c[1]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	f, err := cnf.EncodePattern(p)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode the target: %v", err)
+	}
+	if !relaxed {
+		for _, c := range ring {
+			f.Clauses = append(f.Clauses, []int{-cnf.Var(w, c[0], c[1])})
+		}
+	}
+	s := sat.New(f.NumVars)
+	for _, clause := range f.Clauses {
+		ok, err := s.AddClause(clause)
+		if err != nil {
+			return nil, fmt.Errorf("cannot add a clause: %v", err)
+		}
+		if !ok {
+			return nil, nil
+		}
+	}
+	if !s.Solve() {
+		return nil, nil
+	}
+	return satParent(s, padded)
+}
+
+// SolveUnbounded searches for a parent of the target on the unbounded plane.
+//
+// All the cells outside of the target are dead, but the parent may have
+// living cells up to a margin away from it. The margin grows by MarginStep,
+// up to maxMargin, until a parent is found. For every margin the problem is
+// solved twice with the built-in SAT solver. First with the parent free in
+// the outermost ring, and the target "don't care" there: this is a relaxation
+// of the problem for every larger margin too, so if it has no solution the
+// target has no parents on the plane at all, and the search ends with Orphan.
+// Then with the outermost ring of the parent dead, which gives a parent with
+// all the cells beyond it dead, so that nothing grows outside of the padded
+// target.
+//
+// If neither search succeeds up to maxMargin the result is undecided: it has
+// no Parent, and it is not an Orphan. The rules giving birth to cells with no
+// living neighbours are not supported.
+func SolveUnbounded(target *grid.Grid, maxMargin int) (*Unbounded, error) {
+	if target.Rule().Next(0).IsAlive() {
+		return nil, fmt.Errorf("the %s rule gives birth to cells with no living neighbours, so the plane cannot stay dead", target.Rule())
+	}
+	rv := &Unbounded{}
+	for margin := MarginStep - 1; margin <= maxMargin; margin += MarginStep {
+		padded := pad(target, uint(margin+1))
+		rv.Margin = margin
+		rv.Target = padded
+		relaxed, err := solveUnbounded(padded, true)
+		if err != nil {
+			return nil, err
+		}
+		if relaxed == nil {
+			rv.Orphan = true
+			return rv, nil
+		}
+		if rv.Parent, err = solveUnbounded(padded, false); err != nil || rv.Parent != nil {
+			return rv, err
+		}
+	}
+	return rv, nil
+}
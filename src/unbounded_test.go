@@ -0,0 +1,154 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package solver
+
+import (
+	"testing"
+
+	"github.com/pawelz/efilfoemag/src/neighborhood"
+	"github.com/pawelz/efilfoemag/src/state"
+)
+
+func TestSolveUnbounded(t *testing.T) {
+	for _, td := range []struct {
+		name      string
+		target    string
+		rule      string
+		maxMargin int
+		undecided bool
+		orphan    bool
+	}{
+		{
+			name: "blinker at the edge",
+			target: `8x8
+++++++++
+++++++++
+++++++++
+#+++++++
+#+++++++
+#+++++++
+++++++++
+++++++++
+`,
+			maxMargin: 11,
+		},
+		{
+			name: "dense",
+			target: `8x8
+#+##++##
+#++++##+
+#++##+#+
++##+#+++
+++###+##
+++++###+
+++++##++
+#+++##++
+`,
+			maxMargin: 11,
+		},
+		{
+			name: "no margin",
+			target: `8x8
+++++++++
+++++++++
+++++++++
+#+++++++
+#+++++++
+#+++++++
+++++++++
+++++++++
+`,
+			// The margins start at 0, so none is searched.
+			maxMargin: -1,
+			undecided: true,
+		},
+		{
+			name: "nothing lives",
+			target: `8x8
+++++++++
+++++++++
+++++++++
++++#++++
+++++++++
+++++++++
+++++++++
+++++++++
+`,
+			rule:      "B/S",
+			maxMargin: 11,
+			orphan:    true,
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			target := parseGrid(td.target, t)
+			if td.rule != "" {
+				rule, err := neighborhood.ParseRule(td.rule)
+				if err != nil {
+					t.Fatal(err)
+				}
+				target.SetRule(rule)
+			}
+			got, err := SolveUnbounded(target, td.maxMargin)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Orphan != td.orphan {
+				t.Fatalf("got Orphan %v, want %v", got.Orphan, td.orphan)
+			}
+			if td.orphan {
+				if got.Parent != nil || got.Margin != MarginStep-1 {
+					t.Errorf("want no parent at the first margin, got margin %d and:\n%v", got.Margin, got.Parent)
+				}
+				return
+			}
+			if td.undecided {
+				if got.Parent != nil {
+					t.Errorf("want no parent, got:\n%s", got.Parent.ToEfil())
+				}
+				return
+			}
+			if got.Parent == nil {
+				t.Fatalf("want a parent, got none")
+			}
+			if err := Check(got.Parent, got.Target); err != nil {
+				t.Errorf("invalid parent:\n%s\n%v", got.Parent.ToEfil(), err)
+			}
+			w, h := got.Parent.Width(), got.Parent.Height()
+			for y := uint(0); y < h; y++ {
+				for x := uint(0); x < w; x++ {
+					s, err := got.Parent.Get(x, y)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if (x == 0 || y == 0 || x == w-1 || y == h-1) && s == state.Alive {
+						t.Errorf("cell (%d, %d) of the outermost ring of the parent is alive:\n%s", x, y, got.Parent.ToEfil())
+					}
+				}
+			}
+			want := int(w-target.Width()) / 2
+			for y := uint(0); y < target.Height(); y++ {
+				for x := uint(0); x < target.Width(); x++ {
+					s, err := target.Get(x, y)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if padded, err := got.Target.Get(x+uint(want), y+uint(want)); err != nil || padded != s {
+						t.Errorf("cell (%d, %d) of the padded target is %v, want %v", x, y, padded, s)
+					}
+				}
+			}
+		})
+	}
+}